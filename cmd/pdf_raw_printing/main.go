@@ -1,23 +1,23 @@
 package main
 
 import (
-	"archive/zip"
-	"encoding/hex"
+	"context"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"os/exec"
 	"path"
-	"pdf_raw_printing/internal/business"
+	"pdf_raw_printing/pkg/kcb"
+	"pdf_raw_printing/pkg/kindlepdf"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/ledongthuc/pdf"
 	"github.com/rs/zerolog/log"
 )
 
-var header = "fa500a5f0100004020ddd75994b7c56c19d8adff59af4dd5a99b8c844d29ea0634cbf4bfe61b9cc4f74d354f9cf73d3aef83c4105892074231f4fcce99dc91e1ff0218575c459b62d523bdfebe3188fcde3047406ec4bc21542fa0c6645559e171ddd75958920742e4dffede15bd362bef83c41034cbf4bf71ddd7591e3b506da70511646e1b5a9df74d354f399e153df3e679a5817be72b94b7c56cf3e679a571ddd759c60baec3b52d2b05f74d354fa705116471ddd759531c714965a85bf5c60baec3707780f26c7b8454c60baec334cbf4bfc60baec3138d854b15bd362b58920742b52d2b051e3b506da84b07ec34cbf4bf0d4d3cd0bb386639d1f64457399e153dd16a935b138d854bf74d354ff74d354fbb386639c60baec3725f3cd3e61b9cc40d4d3cd0a84b07ec94b7c56cf74d354f817be72b71ddd759d1f644573ae34e5ca7051164dd2f7d283ae34e5cf3e679a5ef83c410138d854be25aace0bb386639b52d2b0571ddd759ef83c41071ddd759ed8cc4f7399e153d817be72b531c7149f74d354f71ddd7595892074215bd362ba84b07ec6c7b84546c7b845415bd362b3ed5e703f3e679a578e2cd1df74d354fef83c41034cbf4bf67c37d7c426d947e34cbf4bfb52d2b05e61b9cc499dc91e1426d947e71ddd7596c7b8454ed8cc4f758920742f74d354f65a85bf534cbf4bf531c714934cbf4bf589207427d0f472f725f3cd39cf73d3a67c37d7ca4b451a0725f3cd371ddd75934cbf4bfbb386639f3e679a5abcd7eb5399e153d707780f271ddd759bb38663934cbf4bf3ed5e703138d854b138d854be61b9cc467c37d7ca84b07ec6e1b5a9d426d947e34cbf4bfabcd7eb531f4fcce817be72b707780f2ed8cc4f771ddd759abcd7eb53ed5e703707780f2b52d2b05c60baec3817be72bd1f64457a4b451a0e25aace06e1b5a9dbb3866399cf73d3a58920742e61b9cc4bb3866391e3b506d78e2cd1d7d0f472f531c7149817be72bf3e679a56e1b5a9da70511640d4d3cd015bd362b65a85bf5817be72b138d854bbb386639e61b9cc46c7b845471ddd759abcd7eb565a85bf51e3b506dbb386639abcd7eb5707780f26e1b5a9ddd2f7d2834cbf4bfbb38663978e2cd1d0d4d3cd0c3344a3cc3344a3c71ddd759bb386639abcd7eb57d0f472f6e1b5a9dd16a935b31f4fcce6e1b5a9d99dc91e13ae34e5cbb3866397d0f472fa4b451a0c3344a3cd1f64457707780f2817be72b210e6c8f5892074234cbf4bf399e153ddd2f7d2834cbf4bf399e153da84b07ec3ed5e703e25aace0bb3866393ed5e7036e1b5a9dbb3866396e1b5a9da4b451a015bd362b6c7b8454dd2f7d286e1b5a9d5892074278e2cd1da4b451a0e4dffede9cf73d3aa4b451a031f4fcceb52d2b053ae34e5c3ae34e5c34cbf4bfe4dffede15bd362ba4b45100"
-
 var reg = regexp.MustCompile(`(.*)\.pdf$`)
 
 func main() {
@@ -25,11 +25,90 @@ func main() {
 	folderPtr := flag.String("folder", "", "source pdf folder to be converted to kfx")
 	calibrePtr := flag.String("calibre", "/Applications/calibre.app/Contents/MacOS/calibre-debug", "calibre path")
 	destPtr := flag.String("dest", "", "destination folder")
+	outPtr := flag.String("out", "", "kpf of a single book, kept as is: calibre is not run (- writes it to stdout) (default <dest>/<name>.kpf)")
 	kindlePtr := flag.Bool("kindle", false, "scan kindle and convert automatically the ")
 	deletePtr := flag.Bool("delete", false, "remove source pdf")
+	validatePtr := flag.String("validate", "", "check the integrity of a generated kpf or kdf and exit")
+	pagesPtr := flag.String("pages", "", "pages to convert, such as 1-20,35,40- (default all)")
+	splitEveryPtr := flag.Int("split-every", 0, "split the book into volumes of N pages")
+	splitOutlinePtr := flag.Bool("split-outline", false, "split the book into one volume per top level outline entry")
+	mergePtr := flag.String("merge", "", "comma separated pdfs merged in order into one book")
+	coverPtr := flag.String("cover", "", "jpg or png cover image")
+	autoCropPtr := flag.String("auto-crop", "", "crop the white margins around the content of each page (page) or of the whole document (document)")
+	cropPaddingPtr := flag.Float64("crop-padding", 10, "points kept around the content by auto-crop")
+	viewsPtr := flag.String("views", "", "split each page into views: halves, columns or RxC such as 3x2")
+	viewsOverlapPtr := flag.Float64("views-overlap", 0, "percent of its neighbours shown by each view, from 0 to less than 100")
+	viewsRTLPtr := flag.Bool("views-rtl", false, "read the columns of the views from right to left")
+	columnsPtr := flag.Bool("columns", false, "detect two column pages and show each column as its own view, in the reading direction (not with -views)")
+	directionPtr := flag.String("direction", "ltr", "reading direction, ltr or rtl")
+	comicPtr := flag.Bool("comic", false, "mark the book as a manga or a comic")
+	panelMovementPtr := flag.String("panel-movement", "none", "how the virtual panels of a comic are moved through: none, horizontal or vertical")
+	platformPtr := flag.String("platform", "", "platform recorded in the Kindle Create project (default mac)")
+	toolVersionPtr := flag.String("tool-version", "", "Kindle Create version recorded in the project (default 1.96.0.0)")
+	coverPagePtr := flag.Int("cover-page", 0, "page of the pdf marked as the cover, numbered across the pdfs with -merge")
+	startPagePtr := flag.Int("start-page", 0, "page of the pdf where reading starts, numbered across the pdfs with -merge (default the first chapter or introduction of the outline)")
+	bookIdPtr := flag.String("book-id", "", "pin the book id, so a new conversion replaces the book on the device (default derived from the pdf)")
+	bookIdFromPtr := flag.String("book-id-from", "content", "derive the book id from the content of the pdf (content) or from its /ID (pdf-id)")
+	cropPtr := flag.String("crop", "", "margins to crop, such as 36, 5%,10%, or odd:36,72,36,36;even:36,36,36,72;1-3:0 (points unless %)")
 
 	flag.Parse()
 
+	if validatePtr != nil && *validatePtr != "" {
+		err := kindlepdf.Validate(*validatePtr)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("valid")
+		return
+	}
+
+	if *bookIdFromPtr != "content" && *bookIdFromPtr != "pdf-id" {
+		fmt.Printf("invalid book-id-from %q, expected content or pdf-id\n", *bookIdFromPtr)
+		os.Exit(1)
+	}
+
+	if *columnsPtr && *viewsPtr != "" {
+		fmt.Println("columns can't be used with views")
+		os.Exit(1)
+	}
+
+	if *viewsOverlapPtr < 0 || *viewsOverlapPtr >= 100 {
+		fmt.Printf("invalid views-overlap %v, expected a percent from 0 to less than 100\n", *viewsOverlapPtr)
+		os.Exit(1)
+	}
+
+	date, err := sourceDate()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	panelMovement, err := kcb.ParsePanelMovement(*panelMovementPtr)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	opts := kindlepdf.Options{
+		BookIdFromDocument: *bookIdFromPtr == "pdf-id",
+		Crop:               *cropPtr,
+		AutoCrop:           *autoCropPtr,
+		CropPadding:        *cropPaddingPtr,
+		Views:              *viewsPtr,
+		ViewsOverlap:       *viewsOverlapPtr,
+		ViewsRTL:           *viewsRTLPtr,
+		Columns:            *columnsPtr,
+		Direction:          *directionPtr,
+		Comic:              *comicPtr,
+		CoverPage:          *coverPagePtr,
+		StartPage:          *startPagePtr,
+		SourceDate:         date,
+		PanelMovement:      panelMovement,
+		Platform:           *platformPtr,
+		ToolVersion:        *toolVersionPtr,
+	}
+
 	elements := []string{}
 
 	options := 0
@@ -49,14 +128,32 @@ func main() {
 		options++
 		// search for file in folder
 	}
+	merged := []string{}
+	if mergePtr != nil && *mergePtr != "" {
+		options++
+		for _, el := range strings.Split(*mergePtr, ",") {
+			if el = strings.TrimSpace(el); el != "" {
+				merged = append(merged, el)
+			}
+		}
+		if *pagesPtr != "" || *splitEveryPtr != 0 || *splitOutlinePtr {
+			fmt.Println("merge can't be used with pages/split-every/split-outline")
+			return
+		}
+	}
 
 	if options == 0 {
-		fmt.Println("need at least one option (pdf/folder/kindle)")
+		fmt.Println("need at least one option (pdf/folder/kindle/merge)")
 		return
 	}
 
 	if options > 1 {
-		fmt.Println("need one option (pdf/folder/kindle)")
+		fmt.Println("need one option (pdf/folder/kindle/merge)")
+		return
+	}
+
+	if *outPtr != "" && len(elements) > 1 {
+		fmt.Println("out needs a single book")
 		return
 	}
 
@@ -64,41 +161,99 @@ func main() {
 	if destPtr != nil && *destPtr != "" {
 		dest = *destPtr
 	}
+	// the kpf asked for with -out is kept, calibre would replace it by a kfx
+	calibre := *calibrePtr
+	if *outPtr != "" {
+		calibre = ""
+	}
+	kpfPath := func(name string) string {
+		if *outPtr != "" {
+			return *outPtr
+		}
+		return path.Join(dest, name+".kpf")
+	}
 
-	wd, _ := os.Getwd()
-	cw := path.Join(wd, ".tempBook")
-
-	for _, el := range elements {
-		pdfname, err := convertPDF(el)
+	if *coverPtr != "" {
+		cover, err := os.Open(*coverPtr)
 		if err != nil {
-			log.Fatal().Err(err).Msg("failed to convert pdf to kpf")
+			log.Fatal().Err(err).Msg("failed to open cover")
 		}
-		ui := path.Base(pdfname)
-		ui = reg.ReplaceAllString(ui, "$1")
-		archive, err := os.Create(path.Join(dest, ui+".kpf"))
+		defer cover.Close()
+		opts.Cover = cover
+	}
+
+	if len(merged) > 0 {
+		docs := []kindlepdf.Document{}
+		for _, el := range merged {
+			f, err := os.Open(el)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to read pdfs to merge")
+			}
+			defer f.Close()
+			docs = append(docs, kindlepdf.Document{Reader: f, Name: path.Base(el)})
+		}
+
+		ui := reg.ReplaceAllString(path.Base(merged[0]), "$1")
+		v := opts
+		v.BookId = *bookIdPtr
+		writeVolume(kpfPath(ui), calibre, func(w io.Writer) error {
+			v.Output = w
+			_, err := kindlepdf.Merge(context.Background(), docs, v)
+			return err
+		})
+
+		if deletePtr != nil && *deletePtr {
+			for _, el := range merged {
+				err = os.Remove(el)
+				if err != nil {
+					log.Warn().Err(err).Msg("failed to remove pdf")
+				}
+			}
+		}
+	}
+
+	for _, el := range elements {
+		f, err := os.Open(el)
 		if err != nil {
-			log.Fatal().Err(err).Msg("failed to create archive")
+			log.Fatal().Err(err).Msg("failed to open pdf")
 		}
-		defer archive.Close()
-		zipWriter := zip.NewWriter(archive)
-		fsys := os.DirFS(path.Join(cw, "KPF"))
 
-		err = zipWriter.AddFS(fsys)
+		volumes, err := kindlepdf.Volumes(f, kindlepdf.VolumeOptions{
+			Pages:     *pagesPtr,
+			Every:     *splitEveryPtr,
+			ByOutline: *splitOutlinePtr,
+			Name:      path.Base(el),
+		})
 		if err != nil {
-			log.Fatal().Err(err).Msg("failed to compress file")
+			log.Fatal().Err(err).Msg("failed to select pages")
 		}
-		zipWriter.Close()
+		if *outPtr != "" && len(volumes) > 1 {
+			log.Fatal().Msg("out needs a single book")
+		}
+
+		ui := path.Base(el)
+		ui = reg.ReplaceAllString(ui, "$1")
 
-		if calibrePtr != nil {
-			cmd := exec.Command(*calibrePtr, "-r", "KFX Output", "--", "-p", "0", path.Join(dest, ui+".kpf"))
-			if err := cmd.Run(); err != nil {
-				log.Fatal().Err(err)
+		for i, volume := range volumes {
+			name := ui
+			if len(volumes) > 1 {
+				name = fmt.Sprintf("%s.%d", ui, i+1)
 			}
-			err = os.Remove(path.Join(dest, ui+".kpf"))
-			if err != nil {
-				log.Fatal().Err(err)
+
+			v := opts
+			v.Title = volume.Title
+			v.Pages = volume.Pages
+			v.BookId = *bookIdPtr
+			if v.BookId != "" && len(volumes) > 1 {
+				v.BookId = fmt.Sprintf("%s-%d", v.BookId, i+1)
 			}
+			writeVolume(kpfPath(name), calibre, func(w io.Writer) error {
+				v.Output = w
+				_, err := kindlepdf.Convert(context.Background(), f, v)
+				return err
+			})
 		}
+		f.Close()
 
 		if deletePtr != nil && *deletePtr {
 			err = os.Remove(el)
@@ -135,60 +290,51 @@ func searchFolder(rootpath string) ([]string, error) {
 	return filesPDF, nil
 }
 
-func convertPDF(pdfpath string) (string, error) {
-	wd, _ := os.Getwd()
-	cw := path.Join(wd, ".tempBook")
-	_ = os.RemoveAll(cw)
-	err := os.Mkdir(cw, 0777)
-	if err != nil {
-		return "", err
+// writeVolume writes a book to a kpf, then converts it to a kfx when calibre
+// is set. A kpf path of - writes the kpf to stdout.
+func writeVolume(kpfpath string, calibre string, convert func(w io.Writer) error) {
+	if kpfpath == "-" {
+		if err := convert(os.Stdout); err != nil {
+			log.Fatal().Err(err).Msg("failed to convert pdf to kpf")
+		}
+		return
 	}
 
-	f, r, err := pdf.Open(pdfpath)
-	defer func() { _ = f.Close() }()
-
+	archive, err := os.Create(kpfpath)
 	if err != nil {
-		return "", err
+		log.Fatal().Err(err).Msg("failed to create archive")
 	}
 
-	totalPage := r.NumPage()
-
-	err = business.CreateNewPDF(business.PDFInfo{
-		Title:         r.Outline().Title,
-		Autor:         r.Outline().Title,
-		Path:          "res/rsrc8",
-		NumberOfPages: totalPage,
-	}, cw)
+	err = convert(archive)
 	if err != nil {
-		return "", err
+		archive.Close()
+		_ = os.Remove(kpfpath)
+		log.Fatal().Err(err).Msg("failed to convert pdf to kpf")
 	}
+	archive.Close()
 
-	headerBytes, _ := hex.DecodeString(header)
-	AddMissingSQLiteFile(path.Join(cw, "temp.db"), headerBytes, path.Join(cw, "result.db"))
-
-	err = business.CreateArborescence(pdfpath, cw)
-	if err != nil {
-		return "", err
+	if calibre != "" {
+		cmd := exec.Command(calibre, "-r", "KFX Output", "--", "-p", "0", kpfpath)
+		if err := cmd.Run(); err != nil {
+			log.Fatal().Err(err).Msg("failed to run calibre")
+		}
+		err = os.Remove(kpfpath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to remove kpf")
+		}
 	}
-
-	return f.Name(), nil
 }
 
-// Function to add missing sqlite header the SQLite from position 1024 to 2048
-func AddMissingSQLiteFile(inputFile string, header []byte, outputFile string) error {
-	data, err := ioutil.ReadFile(inputFile)
-	if err != nil {
-		return err
+// sourceDate reads SOURCE_DATE_EPOCH, the unix time clamping the timestamps
+// of reproducible builds, zero when unset
+func sourceDate() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Time{}, nil
 	}
-	if len(data) < 2048 {
-		return fmt.Errorf("file size is less than 2048 bytes")
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q", epoch)
 	}
-
-	modifiedData := make([]byte, len(data)+len(header))
-	copy(modifiedData[:1024], data[:1024])
-	copy(modifiedData[1024:], header)
-	copy(modifiedData[1024+len(header):], data[1024:])
-
-	// Remove bytes from position 1024 to 2048
-	return ioutil.WriteFile(outputFile, modifiedData, 0644)
+	return time.Unix(seconds, 0).UTC(), nil
 }
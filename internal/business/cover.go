@@ -0,0 +1,80 @@
+package business
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+)
+
+// Cover is an image shown ahead of the pages and as the library thumbnail
+type Cover struct {
+	// Path is the image file on disk
+	Path string
+	// Reader reads the image, the file at Path being read when nil
+	Reader io.ReaderAt
+	// Resource is the name of the raw media holding the image in the book
+	Resource string
+	// Format is the image format symbol, jpg or png
+	Format string
+	Width  int
+	Height int
+	Info   ResourceInfo
+}
+
+// NewCover reads the format and the size of a jpg or png cover
+func NewCover(path string, resource string) (Cover, error) {
+	info, err := ReadResourceInfo(path)
+	if err != nil {
+		return Cover{}, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Cover{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	cover, err := decodeCover(f, path, resource, info)
+	if err != nil {
+		return Cover{}, err
+	}
+	cover.Path = path
+	return cover, nil
+}
+
+// NewCoverReader reads the format and the size of a jpg or png cover read
+// from r, described by info
+func NewCoverReader(r io.ReaderAt, resource string, info ResourceInfo) (Cover, error) {
+	cover, err := decodeCover(io.NewSectionReader(r, 0, info.Size), "image", resource, info)
+	if err != nil {
+		return Cover{}, err
+	}
+	cover.Reader = r
+	return cover, nil
+}
+
+func decodeCover(r io.Reader, name string, resource string, info ResourceInfo) (Cover, error) {
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return Cover{}, fmt.Errorf("cover %s: %w", name, err)
+	}
+
+	switch format {
+	case "jpeg":
+		format = "jpg"
+	case "png":
+	default:
+		return Cover{}, fmt.Errorf("cover %s: unsupported format %s", name, format)
+	}
+
+	return Cover{
+		Resource: resource,
+		Format:   format,
+		Width:    config.Width,
+		Height:   config.Height,
+		Info:     info,
+	}, nil
+}
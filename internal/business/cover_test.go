@@ -0,0 +1,61 @@
+package business
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCover(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 60, 80))
+
+	jpgPath := path.Join(dir, "cover.jpg")
+	f, err := os.Create(jpgPath)
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(f, img, nil))
+	require.NoError(t, f.Close())
+
+	pngPath := path.Join(dir, "cover.png")
+	f, err = os.Create(pngPath)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, img))
+	require.NoError(t, f.Close())
+
+	cover, err := NewCover(jpgPath, "rsrc2")
+	require.NoError(t, err)
+	info, err := ReadResourceInfo(jpgPath)
+	require.NoError(t, err)
+	require.Equal(t, Cover{Path: jpgPath, Resource: "rsrc2", Format: "jpg", Width: 60, Height: 80, Info: info}, cover)
+
+	cover, err = NewCover(pngPath, "rsrc2")
+	require.NoError(t, err)
+	require.Equal(t, "png", cover.Format)
+
+	_, err = NewCover(path.Join(dir, "missing.png"), "rsrc2")
+	require.Error(t, err)
+
+	textPath := path.Join(dir, "cover.txt")
+	require.NoError(t, os.WriteFile(textPath, []byte("not an image"), 0666))
+	_, err = NewCover(textPath, "rsrc2")
+	require.Error(t, err)
+
+	b, err := os.ReadFile(pngPath)
+	require.NoError(t, err)
+	info, err = ReadResourceInfoAt(bytes.NewReader(b), int64(len(b)), 0)
+	require.NoError(t, err)
+	cover, err = NewCoverReader(bytes.NewReader(b), "rsrc2", info)
+	require.NoError(t, err)
+	require.Equal(t, "png", cover.Format)
+	require.Equal(t, 60, cover.Width)
+	require.NotNil(t, cover.Reader)
+
+	_, err = NewCoverReader(bytes.NewReader([]byte("not an image")), "rsrc2", ResourceInfo{Size: 12})
+	require.Error(t, err)
+}
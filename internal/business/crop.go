@@ -0,0 +1,194 @@
+package business
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Length is a crop length, in points or in percent of the page side
+type Length struct {
+	Value   float64
+	Percent bool
+}
+
+// Points converts the length to points for a page side of the given size
+func (l Length) Points(size float64) float64 {
+	if l.Percent {
+		return l.Value * size / 100
+	}
+	return l.Value
+}
+
+// Margins are lengths cropped from each side of a page
+type Margins struct {
+	Top, Right, Bottom, Left Length
+}
+
+type cropRule struct {
+	// pages selected by the rule, every page when nil
+	pages   map[int]bool
+	margins Margins
+}
+
+// Crop selects the margins of each page of a pdf
+type Crop struct {
+	rules []cropRule
+}
+
+// ParseCrop parses crop rules separated by ";", such as
+// "36;odd:36,72,36,36;even:36,36,36,72;1-3:10%". A rule is an optional page
+// selection (odd, even or pages as in ParsePages) followed by ":" and 1, 2 or
+// 4 lengths in the css order top, right, bottom, left. Lengths are in points
+// unless suffixed by "%", and later rules override earlier ones.
+func ParseCrop(spec string, numberOfPages int) (Crop, error) {
+	crop := Crop{}
+	for _, part := range strings.Split(spec, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		rule := cropRule{}
+		selection, lengths, hasSelection := strings.Cut(part, ":")
+		if !hasSelection {
+			lengths = selection
+		} else {
+			rule.pages = map[int]bool{}
+			switch strings.TrimSpace(selection) {
+			case "odd", "even":
+				start := 0
+				if strings.TrimSpace(selection) == "even" {
+					start = 1
+				}
+				for i := start; i < numberOfPages; i += 2 {
+					rule.pages[i] = true
+				}
+			default:
+				pages, err := ParsePages(selection, numberOfPages)
+				if err != nil {
+					return Crop{}, err
+				}
+				for _, page := range pages {
+					rule.pages[page] = true
+				}
+			}
+		}
+
+		margins, err := parseMargins(lengths)
+		if err != nil {
+			return Crop{}, err
+		}
+		rule.margins = margins
+		crop.rules = append(crop.rules, rule)
+	}
+	return crop, nil
+}
+
+func parseMargins(spec string) (Margins, error) {
+	lengths := []Length{}
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		l := Length{}
+		if strings.HasSuffix(s, "%") {
+			l.Percent = true
+			s = strings.TrimSuffix(s, "%")
+		} else {
+			s = strings.TrimSuffix(s, "pt")
+		}
+
+		value, err := strconv.ParseFloat(s, 64)
+		if err != nil || value < 0 || (l.Percent && value >= 50) {
+			return Margins{}, fmt.Errorf("invalid crop length %q", spec)
+		}
+		l.Value = value
+		lengths = append(lengths, l)
+	}
+
+	switch len(lengths) {
+	case 1:
+		return Margins{lengths[0], lengths[0], lengths[0], lengths[0]}, nil
+	case 2:
+		return Margins{lengths[0], lengths[1], lengths[0], lengths[1]}, nil
+	case 4:
+		return Margins{lengths[0], lengths[1], lengths[2], lengths[3]}, nil
+	}
+	return Margins{}, fmt.Errorf("invalid crop %q, expected 1, 2 or 4 lengths", spec)
+}
+
+// Margins returns the margins of a 0 based page, false when no rule applies
+func (c Crop) Margins(pageIndex int) (Margins, bool) {
+	margins := Margins{}
+	selected := false
+	for _, rule := range c.rules {
+		if rule.pages == nil || rule.pages[pageIndex] {
+			margins = rule.margins
+			selected = true
+		}
+	}
+	return margins, selected
+}
+
+// Bounds is the box holding the content of a page, in points from its lower
+// left corner
+type Bounds struct {
+	Left, Bottom, Right, Top float64
+}
+
+func (b Bounds) IsEmpty() bool {
+	return b.Right <= b.Left || b.Top <= b.Bottom
+}
+
+func (b Bounds) union(o Bounds) Bounds {
+	if b.IsEmpty() {
+		return o
+	}
+	if o.IsEmpty() {
+		return b
+	}
+	return Bounds{
+		Left:   math.Min(b.Left, o.Left),
+		Bottom: math.Min(b.Bottom, o.Bottom),
+		Right:  math.Max(b.Right, o.Right),
+		Top:    math.Max(b.Top, o.Top),
+	}
+}
+
+type AutoCropMode string
+
+const (
+	AutoCropNone AutoCropMode = ""
+	// AutoCropPage crops each page around its own content
+	AutoCropPage AutoCropMode = "page"
+	// AutoCropDocument crops every page around the content of all the pages
+	AutoCropDocument AutoCropMode = "document"
+)
+
+// AutoCrop crops the white margins around the content of the pages, pages
+// selected by a crop rule keeping the margins of the rule
+type AutoCrop struct {
+	Mode AutoCropMode
+	// Padding is kept around the content, in points
+	Padding float64
+}
+
+func ParseAutoCropMode(s string) (AutoCropMode, error) {
+	switch mode := AutoCropMode(s); mode {
+	case AutoCropNone, AutoCropPage, AutoCropDocument:
+		return mode, nil
+	}
+	return AutoCropNone, fmt.Errorf("invalid auto crop mode %q, expected page or document", s)
+}
+
+// margins returns the margins around the bounds of the content
+func (a AutoCrop) margins(bounds Bounds, size PageSize) Margins {
+	pt := func(v float64) Length {
+		return Length{Value: math.Max(0, v-a.Padding)}
+	}
+	return Margins{
+		Top:    pt(size.Height - bounds.Top),
+		Right:  pt(size.Width - bounds.Right),
+		Bottom: pt(bounds.Bottom),
+		Left:   pt(bounds.Left),
+	}
+}
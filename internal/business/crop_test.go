@@ -0,0 +1,107 @@
+package business
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCrop(t *testing.T) {
+	pt := func(v float64) Length { return Length{Value: v} }
+	percent := func(v float64) Length { return Length{Value: v, Percent: true} }
+
+	crop, err := ParseCrop("36;odd:10,20,30,40;even:5%,10pt;3-4:0", 6)
+	require.NoError(t, err)
+
+	margins := func(i int) Margins {
+		m, selected := crop.Margins(i)
+		require.True(t, selected)
+		return m
+	}
+	require.Equal(t, Margins{pt(10), pt(20), pt(30), pt(40)}, margins(0))
+	require.Equal(t, Margins{percent(5), pt(10), percent(5), pt(10)}, margins(1))
+	require.Equal(t, Margins{pt(0), pt(0), pt(0), pt(0)}, margins(2))
+	require.Equal(t, Margins{pt(0), pt(0), pt(0), pt(0)}, margins(3))
+	require.Equal(t, Margins{pt(10), pt(20), pt(30), pt(40)}, margins(4))
+
+	crop, err = ParseCrop("2-:36", 3)
+	require.NoError(t, err)
+	_, selected := crop.Margins(0)
+	require.False(t, selected)
+	require.Equal(t, Margins{pt(36), pt(36), pt(36), pt(36)}, margins(2))
+
+	crop, err = ParseCrop("", 3)
+	require.NoError(t, err)
+	_, selected = crop.Margins(0)
+	require.False(t, selected)
+
+	for _, spec := range []string{"a", "1,2,3", "60%", "-1", "5:10", "odd:"} {
+		_, err := ParseCrop(spec, 3)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestSelectedPages(t *testing.T) {
+	crop, err := ParseCrop("10%,36", 2)
+	require.NoError(t, err)
+
+	source := Source{
+		Path:          "a.pdf",
+		NumberOfPages: 2,
+		PageSizes:     []PageSize{{Width: 600, Height: 800}},
+		Crop:          crop,
+	}
+
+	pages, err := source.SelectedPages()
+	require.NoError(t, err)
+	require.Len(t, pages, 2)
+	require.Equal(t, Page{Index: 0, Size: PageSize{600, 800}, Top: 80, Right: 36, Bottom: 80, Left: 36}, pages[0])
+	require.Equal(t, 528.0, pages[0].Width())
+	require.Equal(t, 640.0, pages[0].Height())
+
+	// pages of unknown size are A4
+	require.Equal(t, DefaultPageSize, pages[1].Size)
+
+	crop, err = ParseCrop("300", 2)
+	require.NoError(t, err)
+	source.Crop = crop
+	_, err = source.SelectedPages()
+	require.Error(t, err)
+}
+
+func TestAutoCrop(t *testing.T) {
+	crop, err := ParseCrop("4:0", 4)
+	require.NoError(t, err)
+
+	source := Source{
+		Path:          "a.pdf",
+		NumberOfPages: 4,
+		PageSizes:     []PageSize{{600, 800}, {600, 800}, {600, 800}, {600, 800}},
+		ContentBounds: []Bounds{{100, 100, 500, 700}, {50, 200, 400, 600}, {}, {100, 100, 500, 700}},
+		Crop:          crop,
+		AutoCrop:      AutoCrop{Mode: AutoCropPage, Padding: 10},
+	}
+
+	margins := func(p Page) [4]float64 {
+		return [4]float64{p.Top, p.Right, p.Bottom, p.Left}
+	}
+
+	pages, err := source.SelectedPages()
+	require.NoError(t, err)
+	require.Equal(t, [4]float64{90, 90, 90, 90}, margins(pages[0]))
+	require.Equal(t, [4]float64{190, 190, 190, 40}, margins(pages[1]))
+	// blank pages and pages selected by a crop rule are not cropped
+	require.Equal(t, [4]float64{0, 0, 0, 0}, margins(pages[2]))
+	require.Equal(t, [4]float64{0, 0, 0, 0}, margins(pages[3]))
+
+	source.AutoCrop.Mode = AutoCropDocument
+	source.Pages = []int{0, 1, 2}
+	pages, err = source.SelectedPages()
+	require.NoError(t, err)
+	for _, page := range pages {
+		require.Equal(t, [4]float64{90, 90, 90, 40}, margins(page))
+	}
+
+	_, err = ParseAutoCropMode("all")
+	require.Error(t, err)
+}
@@ -1,141 +1,149 @@
 package business
 
 import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
 	"os"
-	"path"
-
-	"github.com/google/uuid"
+	"pdf_raw_printing/internal/libs/kdf"
+	"pdf_raw_printing/pkg/kcb"
+	"slices"
+	"sort"
 )
 
-func CreateKCB(tempfolder string) error {
-	id, err := uuid.NewUUID()
-	if err != nil {
-		return err
+// NewKCB returns the Kindle Create project of a book
+func NewKCB(pdfInfo PDFInfo) kcb.KCB {
+	k := kcb.New()
+	k.BookState.MangaComic = pdfInfo.Comic
+	if pdfInfo.Direction == DirectionRTL {
+		k.BookState.ReadingDirection = kcb.RightToLeft
 	}
+	k.BookState.VirtualPanelMovement = pdfInfo.Project.PanelMovement
 
-	input := `{
-	"book_state" : {
-		"book_input_type" : 1,
-		"book_manga_comic" : false,
-		"book_reading_direction" : 0,
-		"book_target_type" : 1,
-		"book_virtual_panelmovement" : 0
-	},
-	"content_hash" : null,
-	"metadata" : {
-		"book_path" : "resources",
-		"edited_tool_versions" : [ "1.93.0.0", "1.96.0.0" ],
-		"format" : "yj",
-		"global_styling" : true,
-		"id" : "` + id.String() + `",
-		"platform" : "mac",
-		"tool_name" : "KC",
-		"tool_version" : "1.96.0.0"
-	},
-	"tool_data" : {
-		"cache_path" : "resources/.cache",
-		"created_on" : "2024-Sep-11 18:13:04",
-		"last_modified_time" : "2025-Feb-14 22:17:16",
-		"link_extract_choice" : false,
-		"link_notification_preference" : true
+	if hash := pdfInfo.ContentHash(); hash != "" {
+		k.ContentHash = &hash
 	}
-}`
 
-	f, err := os.Create(tempfolder + "/mybook.kcb")
-	if err != nil {
-		return err
+	k.Metadata.Id = pdfInfo.BookId()
+	if pdfInfo.Project.Platform != "" {
+		k.Metadata.Platform = pdfInfo.Project.Platform
 	}
-	defer f.Close()
-	_, err = f.WriteString(input)
-	if err != nil {
-		return err
+	if version := pdfInfo.Project.ToolVersion; version != "" {
+		k.Metadata.ToolVersion = version
+		if !slices.Contains(k.Metadata.EditedToolVersions, version) {
+			k.Metadata.EditedToolVersions = append(k.Metadata.EditedToolVersions, version)
+		}
 	}
 
-	return nil
+	k.ToolData.CreatedOn.Time = pdfInfo.Timestamp()
+	if !pdfInfo.Project.CreatedOn.IsZero() {
+		k.ToolData.CreatedOn.Time = pdfInfo.Project.CreatedOn
+	}
+	k.ToolData.LastModifiedTime.Time = pdfInfo.Timestamp()
+	if !pdfInfo.Project.ModifiedOn.IsZero() {
+		k.ToolData.LastModifiedTime.Time = pdfInfo.Project.ModifiedOn
+	}
+	return k
 }
 
-func CreateManifestFile(tempfolder string) error {
-	manifestfile := `AmazonYJManifest
+// manifestFile points the reader of a kpf to its book.kdf
+const manifestFile = `AmazonYJManifest
 digital_content_manifest::{
   version:1,
   storage_type:"localSqlLiteDB",
   digital_content_name:"book.kdf"
 }`
-	f, err := os.Create(tempfolder + "/resources/ManifestFile")
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	_, err = f.WriteString(manifestfile)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func CreateJournal(tempfolder string) error {
-	f, err := os.Create(tempfolder + "/resources/book.kdf-journal")
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	_, err = f.WriteString("")
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func CreateArborescence(pdfpath string, tempfolder1 string) error {
-	err := os.Mkdir(path.Join(tempfolder1, "KPF"), 0777)
-	if err != nil {
-		panic(err)
-	}
-
-	tempfolder := path.Join(tempfolder1, "KPF")
-	err = CreateKCB(tempfolder)
-	if err != nil {
-		return err
-	}
-	err = os.Mkdir(path.Join(tempfolder, "resources"), 0777)
-	if err != nil {
-		panic(err)
-	}
-	err = CreateManifestFile(tempfolder)
-	if err != nil {
-		return err
-	}
 
-	err = copyDst(path.Join(tempfolder1, "result.db"), path.Join(tempfolder, "resources", "book.kdf"))
-	if err != nil {
-		return err
-	}
-
-	err = os.Mkdir(path.Join(tempfolder, "resources", "/res"), 0777)
-	if err != nil {
-		panic(err)
-	}
-
-	err = copyDst(pdfpath, path.Join(tempfolder, "resources", "res", "rsrc8"))
-	if err != nil {
-		return err
-	}
-	return nil
+// kpfEntry is a file of a kpf, written by write, or a directory when write is
+// nil
+type kpfEntry struct {
+	name  string
+	write func(w io.Writer) error
 }
 
-func copyDst(src string, dst string) error {
-	// Read all content of src to data, may cause OOM for a large file.
-	data, err := os.ReadFile(src)
-	if err != nil {
-		return err
-	}
-	// Write data to dst
-	err = os.WriteFile(dst, data, 0644)
+// WriteKPF streams the kpf of a book to w: its KCB, the book.kdf wrapping
+// the SQLite database at dbpath and the pdfs and the cover read from their
+// source. The entries are in lexical order with fixed modes and modification
+// time so the same book gives the same bytes.
+func WriteKPF(w io.Writer, pdfInfo PDFInfo, dbpath string) error {
+	project, err := NewKCB(pdfInfo).Marshal()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	writeBytes := func(b []byte) func(w io.Writer) error {
+		return func(w io.Writer) error {
+			_, err := w.Write(b)
+			return err
+		}
+	}
+	writeResource := func(path string, r io.ReaderAt, info ResourceInfo) func(w io.Writer) error {
+		return func(w io.Writer) error {
+			f, err := openResource(path, r, info)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(w, f)
+			return err
+		}
+	}
+
+	entries := []kpfEntry{
+		{name: "mybook.kcb", write: writeBytes(project)},
+		{name: "resources/"},
+		{name: "resources/ManifestFile", write: writeBytes([]byte(manifestFile))},
+		{name: "resources/book.kdf", write: func(w io.Writer) error {
+			f, err := os.Open(dbpath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return kdf.Wrap(w, f)
+		}},
+		{name: "resources/book.kdf-journal", write: writeBytes(nil)},
+		{name: "resources/res/"},
+	}
+	for _, source := range pdfInfo.Sources {
+		entries = append(entries, kpfEntry{
+			name:  "resources/res/" + source.Resource,
+			write: writeResource(source.Path, source.Reader, source.Info),
+		})
+	}
+	if cover := pdfInfo.Cover; cover != nil {
+		entries = append(entries, kpfEntry{
+			name:  "resources/res/" + cover.Resource,
+			write: writeResource(cover.Path, cover.Reader, cover.Info),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	modified := pdfInfo.Timestamp()
+	zipWriter := zip.NewWriter(w)
+	for _, e := range entries {
+		header := &zip.FileHeader{
+			Name:     e.name,
+			Method:   zip.Deflate,
+			Modified: modified,
+		}
+		if e.write == nil {
+			header.Method = zip.Store
+			header.SetMode(fs.ModeDir | 0755)
+			if _, err := zipWriter.CreateHeader(header); err != nil {
+				return err
+			}
+			continue
+		}
+		header.SetMode(0644)
+
+		entry, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if err := e.write(entry); err != nil {
+			return fmt.Errorf("%s: %w", e.name, err)
+		}
+	}
+	return zipWriter.Close()
 }
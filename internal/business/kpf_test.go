@@ -0,0 +1,190 @@
+package business
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"pdf_raw_printing/internal/libs/pdftest"
+	"pdf_raw_printing/pkg/kcb"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateKCB(t *testing.T) {
+	type bookState struct {
+		MangaComic       bool `json:"book_manga_comic"`
+		ReadingDirection int  `json:"book_reading_direction"`
+	}
+	read := func(pdfInfo PDFInfo) bookState {
+		b, err := NewKCB(pdfInfo).Marshal()
+		require.NoError(t, err)
+		kcb := struct {
+			BookState bookState `json:"book_state"`
+		}{}
+		require.NoError(t, json.Unmarshal(b, &kcb))
+		return kcb.BookState
+	}
+
+	require.Equal(t, bookState{MangaComic: false, ReadingDirection: 0}, read(PDFInfo{}))
+	require.Equal(t, bookState{MangaComic: true, ReadingDirection: 1}, read(PDFInfo{Direction: DirectionRTL, Comic: true}))
+}
+
+func TestCreateKCBContentHash(t *testing.T) {
+	pdfInfo := PDFInfo{Sources: []Source{{Info: ResourceInfo{Hash: "aa"}}}}
+	b, err := NewKCB(pdfInfo).Marshal()
+	require.NoError(t, err)
+
+	project := struct {
+		ContentHash *string `json:"content_hash"`
+		ToolData    struct {
+			CreatedOn string `json:"created_on"`
+		} `json:"tool_data"`
+	}{}
+	require.NoError(t, json.Unmarshal(b, &project))
+	require.NotNil(t, project.ContentHash)
+	require.Equal(t, "aa", *project.ContentHash)
+	_, err = time.Parse(kcb.TimeLayout, project.ToolData.CreatedOn)
+	require.NoError(t, err)
+}
+
+func TestNewKCB(t *testing.T) {
+	pdfInfo := PDFInfo{
+		Sources: []Source{{Info: ResourceInfo{ModifiedTime: 1700000000}}},
+		Project: ProjectOptions{
+			PanelMovement: kcb.PanelMovementVertical,
+			Platform:      "windows",
+			ToolVersion:   "1.100.0.0",
+			CreatedOn:     time.Unix(1600000000, 0),
+		},
+	}
+	k := NewKCB(pdfInfo)
+	require.Equal(t, kcb.PanelMovementVertical, k.BookState.VirtualPanelMovement)
+	require.Equal(t, "windows", k.Metadata.Platform)
+	require.Equal(t, "1.100.0.0", k.Metadata.ToolVersion)
+	require.Equal(t, []string{"1.93.0.0", "1.96.0.0", "1.100.0.0"}, k.Metadata.EditedToolVersions)
+	require.Equal(t, time.Unix(1600000000, 0).Unix(), k.ToolData.CreatedOn.Unix())
+	require.Equal(t, pdfInfo.Timestamp(), k.ToolData.LastModifiedTime.Time)
+	require.Equal(t, pdfInfo.BookId(), k.Metadata.Id)
+	require.Nil(t, k.ContentHash)
+}
+
+func TestReproducibleBuild(t *testing.T) {
+	fixture := pdftest.Document{
+		Pages: []pdftest.Page{
+			{Texts: []pdftest.Text{{X: 100, Y: 700, Size: 20, Text: "Contents"}}, Annots: []string{
+				"<< /Type /Annot /Subtype /Link /Rect [100 600 300 620] /Dest [{page 2} /Fit] >>",
+				"<< /Type /Annot /Subtype /Link /Rect [100 500 300 520] /A << /S /URI /URI (https://example.com/) >> >>",
+			}},
+			{Texts: []pdftest.Text{{X: 100, Y: 700, Size: 20, Text: "one"}}},
+			{Texts: []pdftest.Text{{X: 100, Y: 700, Size: 20, Text: "two"}}},
+		},
+	}
+	pdfPath := path.Join(t.TempDir(), "fixture.pdf")
+	require.NoError(t, os.WriteFile(pdfPath, fixture.Bytes(), 0666))
+	info, err := ReadResourceInfo(pdfPath)
+	require.NoError(t, err)
+
+	sizes := []PageSize{}
+	for i := 0; i < 3; i++ {
+		sizes = append(sizes, DefaultPageSize)
+	}
+	pdfInfo := PDFInfo{
+		Title: "title",
+		Autor: "author",
+		Sources: []Source{
+			{
+				Path:          pdfPath,
+				Resource:      ResourceName(0),
+				Info:          info,
+				NumberOfPages: 3,
+				PageSizes:     sizes,
+				PageLabels:    []string{"i", "1", "2"},
+				Links:         [][]Link{{{Bounds: Bounds{100, 600, 300, 620}, PageIndex: 2}, {Bounds: Bounds{100, 500, 300, 520}, PageIndex: -1, URI: "https://example.com/"}}},
+			},
+		},
+		SourceDate: time.Unix(1700000000, 0),
+	}
+
+	convert := func() [32]byte {
+		dir := t.TempDir()
+		require.NoError(t, CreateNewPDF(pdfInfo, dir))
+
+		kpf := bytes.Buffer{}
+		require.NoError(t, WriteKPF(&kpf, pdfInfo, path.Join(dir, "temp.db")))
+		return sha256.Sum256(kpf.Bytes())
+	}
+
+	// the ids, the eid buckets spread over many blocks, the dates and the zip
+	// entries are the same in both conversions
+	require.Equal(t, convert(), convert())
+}
+
+func TestWriteKPF(t *testing.T) {
+	content := pdftest.Document{Pages: []pdftest.Page{{}}}.Bytes()
+	info, err := ReadResourceInfoAt(bytes.NewReader(content), int64(len(content)), 1700000000)
+	require.NoError(t, err)
+	pdfInfo := PDFInfo{
+		Sources: []Source{{
+			Path:          "fixture.pdf",
+			Reader:        bytes.NewReader(content),
+			Resource:      ResourceName(0),
+			Info:          info,
+			NumberOfPages: 1,
+			PageSizes:     []PageSize{DefaultPageSize},
+		}},
+	}
+	dir := t.TempDir()
+	require.NoError(t, CreateNewPDF(pdfInfo, dir))
+
+	kpf := bytes.Buffer{}
+	require.NoError(t, WriteKPF(&kpf, pdfInfo, path.Join(dir, "temp.db")))
+
+	archive, err := zip.NewReader(bytes.NewReader(kpf.Bytes()), int64(kpf.Len()))
+	require.NoError(t, err)
+	names := []string{}
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	require.Equal(t, []string{
+		"mybook.kcb",
+		"resources/",
+		"resources/ManifestFile",
+		"resources/book.kdf",
+		"resources/book.kdf-journal",
+		"resources/res/",
+		"resources/res/rsrc1",
+	}, names)
+
+	// the pdf is streamed from its reader
+	f, err := archive.Open("resources/res/rsrc1")
+	require.NoError(t, err)
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, content, b)
+
+	f, err = archive.Open("resources/book.kdf")
+	require.NoError(t, err)
+	require.NoError(t, validateKDFReader(f))
+
+	// a missing database fails the package
+	require.Error(t, WriteKPF(io.Discard, pdfInfo, path.Join(dir, "missing.db")))
+}
+
+func TestTimestamp(t *testing.T) {
+	pdfInfo := PDFInfo{
+		Sources: []Source{{Info: ResourceInfo{ModifiedTime: 1700000000}}, {Info: ResourceInfo{ModifiedTime: 1600000000}}},
+	}
+	require.Equal(t, time.Unix(1700000000, 0).UTC(), pdfInfo.Timestamp())
+
+	// SOURCE_DATE_EPOCH clamps newer timestamps only
+	pdfInfo.SourceDate = time.Unix(1650000000, 0)
+	require.Equal(t, time.Unix(1650000000, 0).UTC(), pdfInfo.Timestamp())
+	pdfInfo.SourceDate = time.Unix(1800000000, 0)
+	require.Equal(t, time.Unix(1700000000, 0).UTC(), pdfInfo.Timestamp())
+}
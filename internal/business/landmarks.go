@@ -0,0 +1,57 @@
+package business
+
+// LandmarkType is the kind of a landmark of the book
+type LandmarkType string
+
+const (
+	LandmarkCover LandmarkType = "cover_page"
+	// LandmarkStart is where the book opens the first time
+	LandmarkStart LandmarkType = "srl"
+	LandmarkBody  LandmarkType = "bodymatter"
+)
+
+// landmarkOrder is the order of the landmarks in the navigation, with their
+// labels
+var landmarkOrder = []struct {
+	landmark LandmarkType
+	label    string
+}{
+	{LandmarkCover, "Cover"},
+	{LandmarkStart, "Beginning"},
+	{LandmarkBody, "Body"},
+}
+
+// addLandmark marks a location as a landmark, the first location marked
+// winning
+func (pdf *PDF) addLandmark(landmark LandmarkType, location string) {
+	if _, exists := pdf.landmarks[landmark]; !exists && location != "" {
+		pdf.landmarks[landmark] = location
+	}
+}
+
+// landmarkEntries returns the landmarks of the book. The book starts at its
+// first page and its body at its start unless they are marked.
+func (pdf *PDF) landmarkEntries() []NavUnit {
+	if len(pdf.Resources) > 0 {
+		pdf.addLandmark(LandmarkStart, pdf.Resources[0].FirstLocation)
+	}
+	pdf.addLandmark(LandmarkBody, pdf.landmarks[LandmarkStart])
+
+	entries := []NavUnit{}
+	for _, l := range landmarkOrder {
+		location, exists := pdf.landmarks[l.landmark]
+		if !exists {
+			continue
+		}
+		entries = append(entries, NavUnit{
+			Representation: Representation{
+				Label: l.label,
+			},
+			TargetPosition: TargetPosition{
+				Id: location,
+			},
+			LandmarkType: string(l.landmark),
+		})
+	}
+	return entries
+}
@@ -0,0 +1,64 @@
+package business
+
+import "math"
+
+// Link is a link of a page of a source pdf
+type Link struct {
+	// Bounds is the clickable region, in points from the lower left corner of
+	// the page
+	Bounds Bounds
+	// PageIndex is the 0 based page of the source pdf targeted by an internal
+	// link, -1 for an external one
+	PageIndex int
+	// URI is the target of an external link
+	URI string
+}
+
+// linkRegion is a link shown on a view, in hundredths of points from the top
+// left corner of the view as the fixed size of the page container
+type linkRegion struct {
+	anchor                   string
+	top, left, width, height int
+}
+
+// linkRegions returns the links of the page of a view clipped to the view,
+// anchor naming the anchor of a link and returning false for targets left out
+// of the book
+func (source Source) linkRegions(view Page, anchor func(Link) (string, bool)) []linkRegion {
+	if view.Index >= len(source.Links) {
+		return nil
+	}
+
+	visible := Bounds{
+		Left:   view.Left,
+		Bottom: view.Bottom,
+		Right:  view.Size.Width - view.Right,
+		Top:    view.Size.Height - view.Top,
+	}
+
+	regions := []linkRegion{}
+	for _, link := range source.Links[view.Index] {
+		b := Bounds{
+			Left:   math.Max(link.Bounds.Left, visible.Left),
+			Bottom: math.Max(link.Bounds.Bottom, visible.Bottom),
+			Right:  math.Min(link.Bounds.Right, visible.Right),
+			Top:    math.Min(link.Bounds.Top, visible.Top),
+		}
+		if b.IsEmpty() {
+			continue
+		}
+		name, ok := anchor(link)
+		if !ok {
+			continue
+		}
+
+		regions = append(regions, linkRegion{
+			anchor: name,
+			top:    int(math.Round((visible.Top - b.Top) * 100)),
+			left:   int(math.Round((b.Left - visible.Left) * 100)),
+			width:  int(math.Round((b.Right - b.Left) * 100)),
+			height: int(math.Round((b.Top - b.Bottom) * 100)),
+		})
+	}
+	return regions
+}
@@ -0,0 +1,45 @@
+package business
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkRegions(t *testing.T) {
+	source := Source{
+		Links: [][]Link{
+			{
+				{Bounds: Bounds{100, 600, 200, 650}, PageIndex: 3},
+				// across the two halves
+				{Bounds: Bounds{100, 350, 200, 450}, PageIndex: -1, URI: "https://example.com/"},
+				// in the cropped margin
+				{Bounds: Bounds{0, 0, 40, 40}, PageIndex: 3},
+				// to a page left out of the book
+				{Bounds: Bounds{100, 100, 200, 150}, PageIndex: 5},
+			},
+		},
+	}
+	anchor := func(link Link) (string, bool) {
+		switch {
+		case link.URI != "":
+			return "aURI", true
+		case link.PageIndex == 3:
+			return "a3", true
+		}
+		return "", false
+	}
+	page := Page{Index: 0, Size: PageSize{Width: 600, Height: 800}, Top: 50, Right: 50, Bottom: 50, Left: 50}
+
+	require.Equal(t, []linkRegion{
+		{anchor: "a3", top: 10000, left: 5000, width: 10000, height: 5000},
+		{anchor: "aURI", top: 30000, left: 5000, width: 10000, height: 10000},
+	}, source.linkRegions(page, anchor))
+
+	views := Split{Rows: 2, Columns: 1}.Views(page)
+	require.Equal(t, []linkRegion{
+		{anchor: "aURI", top: 0, left: 5000, width: 10000, height: 5000},
+	}, source.linkRegions(views[1], anchor))
+
+	require.Empty(t, source.linkRegions(Page{Index: 1, Size: page.Size}, anchor))
+}
@@ -80,10 +80,27 @@ type BookMetadata struct {
 }
 
 // --- BookNavigation ---
+type Representation struct {
+	Label string `wion:"label"`
+}
+
+type TargetPosition struct {
+	Id     string `wion:"id,annotation=kfx_id"`
+	Offset int    `wion:"offset"`
+}
+
+type NavUnit struct {
+	Representation Representation `wion:"representation"`
+	TargetPosition TargetPosition `wion:"target_position"`
+	LandmarkType   string         `wion:"landmark_type,type=symbol,omit=empty"`
+	Entries        []NavUnit      `wion:"entries,omit=empty"`
+	Annotation     Annotation     `wion:"this,annotation=nav_unit"`
+}
+
 type NavContainer struct {
 	NavType          string     `wion:"nav_type,type=symbol"`
 	NavContainerName string     `wion:"nav_container_name,annotation=kfx_id"`
-	Entries          []string   `wion:"entries"`
+	Entries          []NavUnit  `wion:"entries"`
 	Annotation       Annotation `wion:"this,annotation=nav_container"`
 }
 
@@ -157,12 +174,13 @@ type SpecificReadingOrder struct {
 }
 
 type DocumentData struct {
-	MaxId         int                    `wion:"max_id"`
-	Direction     Symbol                 `wion:"direction"`
-	PanZoom       Symbol                 `wion:"pan_zoom"`
-	AuxiliaryData SpecificAuxiliaryData  `wion:"auxiliary_data"`
-	ReadingOrders []SpecificReadingOrder `wion:"reading_orders"`
-	Annotation    Annotation             `wion:"this,annotation=document_data"`
+	MaxId                    int                    `wion:"max_id"`
+	Direction                Symbol                 `wion:"direction"`
+	PageProgressionDirection Symbol                 `wion:"page_progression_direction,omit=empty"`
+	PanZoom                  Symbol                 `wion:"pan_zoom"`
+	AuxiliaryData            SpecificAuxiliaryData  `wion:"auxiliary_data"`
+	ReadingOrders            []SpecificReadingOrder `wion:"reading_orders"`
+	Annotation               Annotation             `wion:"this,annotation=document_data"`
 }
 
 // --- ExternalSource ---
@@ -181,6 +199,17 @@ type ExternalSource struct {
 	Annotation     Annotation `wion:"this,annotation=external_resource"`
 }
 
+// --- ImageResource ---
+type ImageResource struct {
+	Format         Symbol     `wion:"format"`
+	Location       string     `wion:"location"`
+	AuxiliaryData  Kfxid      `wion:"auxiliary_data"`
+	ResourceWidth  int        `wion:"resource_width"`
+	ResourceHeight int        `wion:"resource_height"`
+	ResourceName   Kfxid      `wion:"resource_name"`
+	Annotation     Annotation `wion:"this,annotation=external_resource"`
+}
+
 // --- I4 ---
 type PageTemplateI4 struct {
 	Id          string     `wion:"kfx_id,annotation=kfx_id"`
@@ -204,6 +233,28 @@ type PageTemplateI5 struct {
 	Annotation   Annotation `wion:"this,annotation=structure"`
 }
 
+// --- Links ---
+// PageLink is a clickable region of a page, in the units of the fixed size
+// of the page container, from its top left corner
+type PageLink struct {
+	Id          string     `wion:"kfx_id,annotation=kfx_id"`
+	Type        Symbol     `wion:"type"`
+	Top         int        `wion:"top"`
+	Left        int        `wion:"left"`
+	FixedWidth  int        `wion:"fixed_width"`
+	FixedHeight int        `wion:"fixed_height"`
+	LinkTo      string     `wion:"link_to,annotation=kfx_id"`
+	Annotation  Annotation `wion:"this,annotation=structure"`
+}
+
+// Anchor is the target of links, either a position in the book or a uri
+type Anchor struct {
+	AnchorName string         `wion:"anchor_name,annotation=kfx_id"`
+	Position   TargetPosition `wion:"position,omit=empty"`
+	Uri        string         `wion:"uri,omit=empty"`
+	Annotation Annotation     `wion:"this,annotation=anchor"`
+}
+
 // --- StoryLine ---
 type StoryLine struct {
 	StoryName   Kfxid      `wion:"story_name"`
@@ -227,3 +278,57 @@ type YJ struct {
 	Contains   []YJContains `wion:"contains"`
 	Annotation Annotation   `wion:"this,annotation=yj.section_pid_count_map"`
 }
+
+// --- LOCATION_MAP ---
+type Location struct {
+	Id     string `wion:"id,annotation=kfx_id"`
+	Offset int    `wion:"offset"`
+}
+
+type LocationMap struct {
+	Locations []Location `wion:"locations"`
+}
+
+type LocationMaps struct {
+	LocationMaps []LocationMap `wion:","`
+	Annotation   Annotation    `wion:"this,type=empty,annotation=location_map"`
+}
+
+// --- CONTENT_FEATURES ---
+type Version struct {
+	MajorVersion int `wion:"major_version"`
+	MinorVersion int `wion:"minor_version"`
+}
+
+type VersionInfo struct {
+	Version Version `wion:"version"`
+}
+
+type Feature struct {
+	Namespace   string      `wion:"namespace"`
+	Key         string      `wion:"key"`
+	VersionInfo VersionInfo `wion:"version_info"`
+}
+
+type ContentFeatures struct {
+	Id         Symbol     `wion:"kfx_id"`
+	Features   []Feature  `wion:"features"`
+	Annotation Annotation `wion:"this,annotation=content_features"`
+}
+
+// --- ROOT_ENTITY ---
+type RootEntity struct {
+	Contains   []Kfxid    `wion:"contains"`
+	Annotation Annotation `wion:"this,annotation=root_entity"`
+}
+
+// --- yj.kfxid_eid_map ---
+type KfxidEid struct {
+	Id  string `wion:"kfx_id,annotation=kfx_id"`
+	Eid int    `wion:"eid"`
+}
+
+type KfxidEidMap struct {
+	Contains   []KfxidEid `wion:"contains"`
+	Annotation Annotation `wion:"this,annotation=yj.kfxid_eid_map"`
+}
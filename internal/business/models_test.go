@@ -124,7 +124,7 @@ func TestSerialize(t *testing.T) {
 							{
 								NavType:          "toc",
 								NavContainerName: "nA",
-								Entries:          []string{},
+								Entries:          []NavUnit{},
 							},
 						},
 					},
@@ -508,3 +508,93 @@ func TestSerialize(t *testing.T) {
 		})
 	}
 }
+
+// Fragments without a Kindle Create reference are checked against their ion
+// text representation
+func TestSerializeGenerated(t *testing.T) {
+	tests := []struct {
+		name     string
+		v        any
+		expected string
+	}{
+		{
+			name: "location_map",
+			v: LocationMaps{
+				LocationMaps: []LocationMap{
+					{
+						Locations: []Location{{Id: "i2"}, {Id: "i4"}},
+					},
+				},
+			},
+			expected: `location_map::[{locations:[{id:kfx_id::"i2",offset:0},{id:kfx_id::"i4",offset:0}]}]`,
+		},
+		{
+			name: "content_features",
+			v: ContentFeatures{
+				Id: Symbol{
+					Value: "content_features",
+				},
+				Features: []Feature{
+					{
+						Namespace: "com.amazon.yjconversion",
+						Key:       "yj_pdf_support",
+						VersionInfo: VersionInfo{
+							Version: Version{MajorVersion: 1, MinorVersion: 0},
+						},
+					},
+				},
+			},
+			expected: `content_features::{kfx_id:content_features,features:[{namespace:"com.amazon.yjconversion",key:"yj_pdf_support",version_info:{version:{major_version:1,minor_version:0}}}]}`,
+		},
+		{
+			name: "cover",
+			v: ImageResource{
+				Format:         Symbol{Value: "jpg"},
+				Location:       "rsrc2",
+				AuxiliaryData:  Kfxid{Id: "d3"},
+				ResourceWidth:  600,
+				ResourceHeight: 800,
+				ResourceName:   Kfxid{Id: "e4"},
+			},
+			expected: `external_resource::{format:jpg,location:"rsrc2",auxiliary_data:kfx_id::"d3",resource_width:600,resource_height:800,resource_name:kfx_id::"e4"}`,
+		},
+		{
+			name: "document_data_rtl",
+			v: DocumentData{
+				MaxId:                    10,
+				Direction:                Symbol{Value: "rtl"},
+				PageProgressionDirection: Symbol{Value: "rtl"},
+				PanZoom:                  Symbol{Value: "enabled"},
+				AuxiliaryData:            SpecificAuxiliaryData{Id: "d7"},
+				ReadingOrders:            []SpecificReadingOrder{},
+			},
+			expected: `document_data::{max_id:10,direction:rtl,page_progression_direction:rtl,pan_zoom:enabled,auxiliary_data:{'yj.authoring':kfx_id::"d7"},reading_orders:[]}`,
+		},
+		{
+			name: "root_entity",
+			v: RootEntity{
+				Contains: []Kfxid{{Id: "document_data"}, {Id: "metadata"}},
+			},
+			expected: `root_entity::{contains:[kfx_id::"document_data",kfx_id::"metadata"]}`,
+		},
+		{
+			name: "yj.kfxid_eid_map",
+			v: KfxidEidMap{
+				Contains: []KfxidEid{{Id: "c1", Eid: 1}, {Id: "i2", Eid: 2}},
+			},
+			expected: `'yj.kfxid_eid_map'::{contains:[{kfx_id:kfx_id::"c1",eid:1},{kfx_id:kfx_id::"i2",eid:2}]}`,
+		},
+	}
+
+	for _, ts := range tests {
+		t.Run(ts.name, func(t *testing.T) {
+			str, err := wion.MarshalString(ts.v)
+			require.NoError(t, err)
+			require.Equal(t, ts.expected+"\n", str)
+
+			hash24, err := wion.Marshal(ts.v)
+			require.NoError(t, err)
+			require.NoError(t, ionreader.ReadDouble(hash24, hash24))
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package business
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParsePages parses a page selection such as "1-20,35,40-" into 0 based page
+// indexes, in the given order. Pages are numbered from 1 and an open range
+// ends at the last page. An empty selection selects every page, and a page
+// can't be selected twice.
+func ParsePages(spec string, numberOfPages int) ([]int, error) {
+	pages := []int{}
+	if strings.TrimSpace(spec) == "" {
+		for i := 0; i < numberOfPages; i++ {
+			pages = append(pages, i)
+		}
+		return pages, nil
+	}
+
+	parsePage := func(s string, defaultValue int) (int, error) {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return defaultValue, nil
+		}
+		page, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid page %q", s)
+		}
+		if page < 1 || page > numberOfPages {
+			return 0, fmt.Errorf("page %d out of range 1-%d", page, numberOfPages)
+		}
+		return page, nil
+	}
+
+	selected := map[int]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+
+		first, err := parsePage(from, 1)
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if isRange {
+			last, err = parsePage(to, numberOfPages)
+			if err != nil {
+				return nil, err
+			}
+		} else if strings.TrimSpace(from) == "" {
+			return nil, fmt.Errorf("empty page selection in %q", spec)
+		}
+
+		if first > last {
+			return nil, fmt.Errorf("invalid page range %q", part)
+		}
+
+		for page := first; page <= last; page++ {
+			if selected[page] {
+				return nil, fmt.Errorf("page %d selected twice in %q", page, spec)
+			}
+			selected[page] = true
+			pages = append(pages, page-1)
+		}
+	}
+
+	return pages, nil
+}
+
+// SplitEvery splits pages into volumes of at most n pages
+func SplitEvery(pages []int, n int) [][]int {
+	if n <= 0 {
+		return [][]int{pages}
+	}
+
+	volumes := [][]int{}
+	for len(pages) > n {
+		volumes = append(volumes, pages[:n])
+		pages = pages[n:]
+	}
+	if len(pages) > 0 {
+		volumes = append(volumes, pages)
+	}
+	return volumes
+}
+
+// SplitAt splits pages into volumes starting at each page index of starts.
+// Pages before the first start belong to the first volume.
+func SplitAt(pages []int, starts []int) [][]int {
+	isStart := map[int]bool{}
+	for _, start := range starts {
+		isStart[start] = true
+	}
+
+	volumes := [][]int{}
+	current := []int{}
+	started := false
+	for _, page := range pages {
+		if isStart[page] {
+			if started && len(current) > 0 {
+				volumes = append(volumes, current)
+				current = []int{}
+			}
+			started = true
+		}
+		current = append(current, page)
+	}
+	if len(current) > 0 {
+		volumes = append(volumes, current)
+	}
+	return volumes
+}
+
+// PageSize is the displayed size of a page, in points
+type PageSize struct {
+	Width, Height float64
+}
+
+// DefaultPageSize is used for pages of unknown size, A4 portrait
+var DefaultPageSize = PageSize{Width: 596, Height: 842}
+
+// Page is a page of a source pdf as shown in the book
+type Page struct {
+	// Index is the 0 based index of the page in the source pdf
+	Index int
+	Size  PageSize
+	// Margins cropped from the page, in points
+	Top, Right, Bottom, Left float64
+}
+
+// Width is the width of the page once cropped
+func (p Page) Width() float64 {
+	return p.Size.Width - p.Left - p.Right
+}
+
+// Height is the height of the page once cropped
+func (p Page) Height() float64 {
+	return p.Size.Height - p.Top - p.Bottom
+}
+
+// SelectedPages returns the pages of the book taken from the source, with
+// their size and crop
+func (source Source) SelectedPages() ([]Page, error) {
+	indexes := source.Pages
+	if len(indexes) == 0 {
+		indexes, _ = ParsePages("", source.NumberOfPages)
+	}
+
+	documentBounds := Bounds{}
+	if source.AutoCrop.Mode == AutoCropDocument {
+		for _, i := range indexes {
+			documentBounds = documentBounds.union(source.contentBounds(i))
+		}
+	}
+
+	pages := []Page{}
+	for _, i := range indexes {
+		bounds := documentBounds
+		if source.AutoCrop.Mode == AutoCropPage {
+			bounds = source.contentBounds(i)
+		}
+
+		page, err := source.page(i, bounds)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+func (source Source) contentBounds(i int) Bounds {
+	if i < len(source.ContentBounds) {
+		return source.ContentBounds[i]
+	}
+	return Bounds{}
+}
+
+// page returns the page i of the source, cropped by the crop rules or else
+// around the bounds of the content when known
+func (source Source) page(i int, bounds Bounds) (Page, error) {
+	size := DefaultPageSize
+	if i < len(source.PageSizes) && source.PageSizes[i].Width > 0 && source.PageSizes[i].Height > 0 {
+		size = source.PageSizes[i]
+	}
+
+	margins, selected := source.Crop.Margins(i)
+	if !selected && source.AutoCrop.Mode != AutoCropNone && !bounds.IsEmpty() {
+		margins = source.AutoCrop.margins(bounds, size)
+	}
+
+	page := Page{
+		Index:  i,
+		Size:   size,
+		Top:    margins.Top.Points(size.Height),
+		Right:  margins.Right.Points(size.Width),
+		Bottom: margins.Bottom.Points(size.Height),
+		Left:   margins.Left.Points(size.Width),
+	}
+	if page.Width() < 1 || page.Height() < 1 {
+		return page, fmt.Errorf("page %d of %s is cropped away", i+1, source.Path)
+	}
+	return page, nil
+}
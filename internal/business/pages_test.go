@@ -0,0 +1,41 @@
+package business
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePages(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected []int
+	}{
+		{spec: "", expected: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{spec: "1-3,5", expected: []int{0, 1, 2, 4}},
+		{spec: "8-", expected: []int{7, 8, 9}},
+		{spec: "-2, 9", expected: []int{0, 1, 8}},
+		{spec: "4,2", expected: []int{3, 1}},
+	}
+
+	for _, ts := range tests {
+		pages, err := ParsePages(ts.spec, 10)
+		require.NoError(t, err, ts.spec)
+		require.Equal(t, ts.expected, pages, ts.spec)
+	}
+
+	for _, spec := range []string{"0", "11", "3-2", "a", "1,,2", "1-b", "1-5,3", "2,2", "-4,3-"} {
+		_, err := ParsePages(spec, 10)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	pages := []int{0, 1, 2, 3, 4, 5, 6}
+
+	require.Equal(t, [][]int{{0, 1, 2}, {3, 4, 5}, {6}}, SplitEvery(pages, 3))
+	require.Equal(t, [][]int{pages}, SplitEvery(pages, 0))
+
+	require.Equal(t, [][]int{{0, 1, 2}, {3, 4}, {5, 6}}, SplitAt(pages, []int{2, 3, 5}))
+	require.Equal(t, [][]int{pages}, SplitAt(pages, []int{}))
+}
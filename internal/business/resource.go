@@ -0,0 +1,144 @@
+package business
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ResourceInfo describes the file of an embedded resource
+type ResourceInfo struct {
+	Size int64
+	// ModifiedTime is the unix time of the last modification
+	ModifiedTime int64
+	// Hash is the hex sha256 of the content
+	Hash string
+}
+
+// ReadResourceInfo reads the size, the modification time and the hash of a
+// file
+func ReadResourceInfo(path string) (ResourceInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ResourceInfo{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return ResourceInfo{}, err
+	}
+
+	return ReadResourceInfoAt(f, stat.Size(), stat.ModTime().Unix())
+}
+
+// ReadResourceInfoAt hashes the size bytes of a resource read from r, last
+// modified at the unix time modifiedTime
+func ReadResourceInfoAt(r io.ReaderAt, size int64, modifiedTime int64) (ResourceInfo, error) {
+	h := sha256.New()
+	_, err := io.Copy(h, io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return ResourceInfo{}, err
+	}
+
+	return ResourceInfo{
+		Size:         size,
+		ModifiedTime: modifiedTime,
+		Hash:         hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// openResource opens the content of a resource, read from r or else from the
+// file at path
+func openResource(path string, r io.ReaderAt, info ResourceInfo) (io.ReadCloser, error) {
+	if r != nil {
+		return io.NopCloser(io.NewSectionReader(r, 0, info.Size)), nil
+	}
+	return os.Open(path)
+}
+
+// ContentHash is the hash of the resources of the book: the hash of the pdf
+// for a single pdf, else the hash of the hashes of the resources in order
+func (pdfInfo PDFInfo) ContentHash() string {
+	hashes := []string{}
+	for _, source := range pdfInfo.Sources {
+		hashes = append(hashes, source.Info.Hash)
+	}
+	if pdfInfo.Cover != nil {
+		hashes = append(hashes, pdfInfo.Cover.Info.Hash)
+	}
+
+	if len(hashes) == 1 {
+		return hashes[0]
+	}
+	h := sha256.Sum256([]byte(strings.Join(hashes, "\n")))
+	return hex.EncodeToString(h[:])
+}
+
+// bookIdNamespace is the namespace of the book ids derived from the pdfs
+var bookIdNamespace = uuid.MustParse("93b83225-bb9b-4817-ac25-4aaa8eb1c392")
+
+// BookId is the id of the book: Id when pinned, else a uuid derived from the
+// content or the /ID of the pdfs and the pages selected, so converting the
+// same pages again keeps the identity of the book and its notes on the
+// device
+func (pdfInfo PDFInfo) BookId() string {
+	if pdfInfo.Id != "" {
+		return pdfInfo.Id
+	}
+
+	seed := []string{}
+	if !pdfInfo.IdFromDocument {
+		seed = append(seed, pdfInfo.ContentHash())
+	}
+	for _, source := range pdfInfo.Sources {
+		if pdfInfo.IdFromDocument {
+			id := source.DocumentId
+			if id == "" {
+				id = source.Info.Hash
+			}
+			seed = append(seed, id)
+		}
+		// volumes of a pdf differ by their pages
+		if len(source.Pages) > 0 {
+			pages := []string{}
+			for _, page := range source.Pages {
+				pages = append(pages, strconv.Itoa(page))
+			}
+			seed = append(seed, source.Resource+":"+strings.Join(pages, ","))
+		}
+	}
+	return uuid.NewSHA1(bookIdNamespace, []byte(strings.Join(seed, "\n"))).String()
+}
+
+// Timestamp is the date of the book: the last modification of its resources,
+// clamped to SourceDate when set, so converting the same files again gives
+// the same book
+func (pdfInfo PDFInfo) Timestamp() time.Time {
+	latest := int64(0)
+	for _, source := range pdfInfo.Sources {
+		latest = max(latest, source.Info.ModifiedTime)
+	}
+	if pdfInfo.Cover != nil {
+		latest = max(latest, pdfInfo.Cover.Info.ModifiedTime)
+	}
+	return time.Unix(clampTime(latest, pdfInfo.SourceDate), 0).UTC()
+}
+
+// clampTime clamps a unix time to a date, unless the date is zero
+func clampTime(t int64, date time.Time) int64 {
+	if date.IsZero() {
+		return t
+	}
+	return min(t, date.Unix())
+}
+
+func formatInt(i int64) string {
+	return strconv.FormatInt(i, 10)
+}
@@ -0,0 +1,65 @@
+package business
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadResourceInfo(t *testing.T) {
+	p := path.Join(t.TempDir(), "a.pdf")
+	require.NoError(t, os.WriteFile(p, []byte("hello"), 0666))
+	modified := time.Unix(1700000000, 0)
+	require.NoError(t, os.Chtimes(p, modified, modified))
+
+	info, err := ReadResourceInfo(p)
+	require.NoError(t, err)
+	require.Equal(t, ResourceInfo{
+		Size:         5,
+		ModifiedTime: 1700000000,
+		Hash:         "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	}, info)
+
+	_, err = ReadResourceInfo(path.Join(t.TempDir(), "missing.pdf"))
+	require.Error(t, err)
+}
+
+func TestContentHash(t *testing.T) {
+	single := PDFInfo{Sources: []Source{{Info: ResourceInfo{Hash: "aa"}}}}
+	require.Equal(t, "aa", single.ContentHash())
+
+	merged := PDFInfo{Sources: []Source{{Info: ResourceInfo{Hash: "aa"}}, {Info: ResourceInfo{Hash: "bb"}}}}
+	require.Len(t, merged.ContentHash(), 64)
+	require.NotEqual(t, merged.ContentHash(), PDFInfo{Sources: []Source{merged.Sources[1], merged.Sources[0]}}.ContentHash())
+
+	withCover := single
+	withCover.Cover = &Cover{Info: ResourceInfo{Hash: "cc"}}
+	require.NotEqual(t, single.ContentHash(), withCover.ContentHash())
+}
+
+func TestBookId(t *testing.T) {
+	info := PDFInfo{Sources: []Source{{Resource: ResourceName(0), Info: ResourceInfo{Hash: "aa"}, DocumentId: "0123"}}}
+	id := info.BookId()
+	require.Len(t, id, 36)
+	require.Equal(t, id, info.BookId())
+
+	// the same pdf with new content keeps its id only when derived from /ID
+	updated := PDFInfo{Sources: []Source{{Resource: ResourceName(0), Info: ResourceInfo{Hash: "bb"}, DocumentId: "0123"}}}
+	require.NotEqual(t, id, updated.BookId())
+	info.IdFromDocument = true
+	updated.IdFromDocument = true
+	require.Equal(t, info.BookId(), updated.BookId())
+	require.NotEqual(t, id, info.BookId())
+
+	// volumes of a pdf get their own id
+	volume := info
+	volume.Sources = []Source{info.Sources[0]}
+	volume.Sources[0].Pages = []int{0, 1}
+	require.NotEqual(t, info.BookId(), volume.BookId())
+
+	info.Id = "pinned"
+	require.Equal(t, "pinned", info.BookId())
+}
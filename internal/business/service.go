@@ -2,53 +2,185 @@ package business
 
 import (
 	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
 	"path"
 	"pdf_raw_printing/internal/libs/db"
 	generator "pdf_raw_printing/internal/libs/idgenerator"
+	"pdf_raw_printing/internal/libs/wion"
+	"pdf_raw_printing/pkg/kcb"
+	"sort"
 	"strconv"
-
-	"github.com/google/uuid"
+	"time"
 )
 
 var DEBUG_ONE_PAGE = false
 
-var ion_symbol_table = "e00100eaeea08183de9c8822034286be95de93848a594a5f73796d626f6c7385210a88220339"
+// ion_symbol_table imports the YJ symbols and declares the local symbols of
+// the book, wion.LocalSymbols
+var ion_symbol_table = "e00100eaeeae8183deaa8822034386be95de93848a594a5f73796d626f6c7385210a8822033987bc8b726f6f745f656e74697479"
+
+type Source struct {
+	// Path is the pdf file on disk, or the name of the pdf read from Reader
+	Path string
+	// Reader reads the pdf, the file at Path being read when nil
+	Reader io.ReaderAt
+	// Resource is the name of the raw media holding the pdf in the book
+	Resource      string
+	Info          ResourceInfo
+	Title         string
+	NumberOfPages int
+	// Pages are the 0 based indexes in the source pdf of the pages of the
+	// book, every page when empty
+	Pages []int
+	// PageSizes are the sizes of the pages of the source pdf, by index
+	PageSizes []PageSize
+	Crop      Crop
+	// ContentBounds are the bounds of the content of the pages of the source
+	// pdf, by index, used to crop automatically
+	ContentBounds []Bounds
+	AutoCrop      AutoCrop
+	// Split cuts each page into views, the pages are kept whole when zero
+	Split Split
+	// Columns are the regions of the pages in columns, by index, such as a
+	// header then the left and right columns, each one shown as a view
+	Columns [][]Bounds
+	// PageLabels are the printed labels of the pages of the source pdf, by
+	// index, such as "iv" or "127"
+	PageLabels []string
+	// Links are the links of the pages of the source pdf, by index
+	Links [][]Link
+	// DocumentId is the permanent identifier of the pdf, the first entry of
+	// its /ID in hex, empty when missing
+	DocumentId string
+	// Landmarks are the 0 based indexes of the pages of the source pdf marked
+	// as landmarks, such as the cover or the start of reading
+	Landmarks map[LandmarkType]int
+}
 
 type PDFInfo struct {
+	Title string
+	Autor string
+	// Id pins the book_id, derived from the pdfs when empty
+	Id string
+	// IdFromDocument derives the book_id from the /ID of the pdfs rather than
+	// from their content
+	IdFromDocument bool
+	Sources        []Source
+	// Cover is the optional cover image
+	Cover *Cover
+	// Direction is the reading direction, left to right when empty
+	Direction Direction
+	// Comic marks the book as a manga or a comic
+	Comic bool
+	// SourceDate clamps the timestamps of the book, as SOURCE_DATE_EPOCH,
+	// unless zero
+	SourceDate time.Time
+	// Project are the settings of the Kindle Create project of the kpf
+	Project ProjectOptions
+}
+
+// ProjectOptions are the settings of the KCB of a kpf, the Kindle Create
+// defaults being kept for the zero values
+type ProjectOptions struct {
+	// PanelMovement is how the virtual panels of a comic are moved through
+	PanelMovement kcb.PanelMovement
+	Platform      string
+	ToolVersion   string
+	// CreatedOn and ModifiedOn are the dates of the project, the timestamp of
+	// the book when zero
+	CreatedOn  time.Time
+	ModifiedOn time.Time
+}
+
+// Direction is the reading direction of a book
+type Direction string
+
+const (
+	DirectionLTR Direction = "ltr"
+	DirectionRTL Direction = "rtl"
+)
+
+func ParseDirection(s string) (Direction, error) {
+	switch direction := Direction(s); direction {
+	case DirectionLTR, DirectionRTL:
+		return direction, nil
+	case "":
+		return DirectionLTR, nil
+	}
+	return DirectionLTR, fmt.Errorf("invalid direction %q, expected ltr or rtl", s)
+}
+
+// Resource is a source pdf embedded in the book
+type Resource struct {
+	Name          string
+	AuxiliaryData string
+	Location      string
 	Title         string
-	Autor         string
-	Path          string
-	Id            string
-	NumberOfPages int
+	// FirstLocation is the eid of the first page of the resource
+	FirstLocation string
+	Info          ResourceInfo
 }
 
 type PDF struct {
-	db         db.DB
+	store db.FragmentStore
+	// generator numbers the ids of the book
+	generator  *generator.Generator
 	Sections   []string
 	Eidbuckets map[int][]KVEid
-	d6         string
+	Locations  []KVEid
+	// PageList maps the first location of each labelled page to its label
+	PageList  []KVEid
+	Resources []Resource
+	// Anchors are the targets of the links of the pages
+	Anchors []Anchor
+	// uriAnchors names the anchor of each external link target
+	uriAnchors map[string]string
+	// pidCounts are the number of positions of each section
+	pidCounts map[string]int
+	// landmarks are the locations of the landmarks of the book
+	landmarks map[LandmarkType]string
+	// ids are the ids used by the book that are not symbols of the catalog
+	ids        map[string]bool
+	bookId     string
+	sourceDate time.Time
+	// cover is the raw media of the cover image, coverImage its external
+	// resource
+	cover      *Resource
+	coverImage string
 	d7         string
 }
 
+// ResourceName is the raw media name of the i-th source of a book
+func ResourceName(i int) string {
+	return "rsrc" + strconv.Itoa(i+1)
+}
+
 type KVEid struct {
 	Key   string
 	Value string
 }
 
-func NewPdf(tempfolder string) (*PDF, error) {
-	myDB, err := db.CreateNewDB(path.Join(tempfolder, "temp.db"))
-
-	if err != nil {
-		return nil, err
-	}
-
+func NewPdf(store db.FragmentStore) *PDF {
 	pdf := PDF{
-		db:         *myDB,
+		store: store,
+		// the ids only depend on the book, so converting it again gives the
+		// same fragments
+		generator:  generator.New(),
 		Sections:   []string{},
 		Eidbuckets: map[int][]KVEid{},
+		Locations:  []KVEid{},
+		PageList:   []KVEid{},
+		Resources:  []Resource{},
+		Anchors:    []Anchor{},
+		uriAnchors: map[string]string{},
+		pidCounts:  map[string]int{},
+		landmarks:  map[LandmarkType]string{},
+		ids:        map[string]bool{},
 	}
 
-	return &pdf, err
+	return &pdf
 }
 
 func ComputeEID(s string) int {
@@ -59,6 +191,28 @@ func ComputeEID(s string) int {
 	return value % 67
 }
 
+// generate allocates a new id for the book
+func (pdf *PDF) generate(prefix string) string {
+	id := pdf.generator.Generate(prefix)
+	pdf.ids[id] = true
+	return id
+}
+
+// register records ids of the book that are not generated, so they are
+// neither generated again nor left out of max_id
+func (pdf *PDF) register(ids ...string) {
+	for _, id := range ids {
+		pdf.generator.Register(id)
+		pdf.ids[id] = true
+	}
+}
+
+// maxId is the largest symbol id of the book: the symbols of the catalog then
+// one per id of the book
+func (pdf *PDF) maxId() int {
+	return len(wion.Items_symbols_string) + len(pdf.ids)
+}
+
 func (pdf *PDF) AddSectionToEidbucket(key string, value string) {
 	eid := ComputeEID(key)
 	var k []KVEid
@@ -72,41 +226,144 @@ func (pdf *PDF) AddSectionToEidbucket(key string, value string) {
 }
 
 func CreateNewPDF(pdfInfo PDFInfo, tempfolder string) error {
-	pdf, err := NewPdf(tempfolder)
+	store, err := db.NewSQLiteStore(path.Join(tempfolder, "temp.db"))
 	if err != nil {
 		return err
 	}
 
+	err = NewPdf(store).Build(pdfInfo)
+	if err == nil {
+		err = Validate(store)
+	}
+	if err != nil {
+		// the half built book is not committed
+		_ = store.Rollback()
+		return err
+	}
+
+	return store.Close()
+}
+
+// Build writes every fragment of the book to the store
+func (pdf *PDF) Build(pdfInfo PDFInfo) error {
 	// Start by creating the init
-	generator.Register("d6")
-	generator.Register("d7")
-	pdf.d6 = "d6"
+	pdf.bookId = pdfInfo.BookId()
+	pdf.sourceDate = pdfInfo.SourceDate
+	pdf.register("d7")
 	pdf.d7 = "d7"
 
-	// Then create each page
-	for i := 0; i < pdfInfo.NumberOfPages; i++ {
-		err := pdf.AddPage(i)
+	// The cover comes ahead of the pages
+	if pdfInfo.Cover != nil {
+		err := pdf.AddCover(*pdfInfo.Cover)
+		if err != nil {
+			return err
+		}
+		pdf.addLandmark(LandmarkCover, pdf.Locations[len(pdf.Locations)-1].Key)
+	}
+
+	// Then create the pages of each source, appended in order and keeping
+	// their index in the source pdf
+	for _, source := range pdfInfo.Sources {
+		// right to left books read the views from right to left too
+		if pdfInfo.Direction == DirectionRTL {
+			source.Split.RTL = true
+		}
+
+		pdf.register(source.Resource)
+		r := Resource{
+			Name:          source.Resource,
+			AuxiliaryData: pdf.generate("d"),
+			Location:      "res/" + source.Resource,
+			Title:         source.Title,
+			Info:          source.Info,
+		}
+
+		pages, err := source.SelectedPages()
 		if err != nil {
 			return err
 		}
 
-		if DEBUG_ONE_PAGE {
-			if i == 0 {
-				break
+		// internal links point at the first view of pages of the book, their
+		// anchors are written once the locations of the pages are known
+		selected := map[int]bool{}
+		for _, page := range pages {
+			selected[page.Index] = true
+		}
+		pageAnchors := map[int]string{}
+		pageLocations := map[int]string{}
+		anchor := func(link Link) (string, bool) {
+			if link.PageIndex < 0 {
+				if link.URI == "" {
+					return "", false
+				}
+				return pdf.uriAnchor(link.URI), true
 			}
+			if !selected[link.PageIndex] {
+				return "", false
+			}
+			if _, exists := pageAnchors[link.PageIndex]; !exists {
+				pageAnchors[link.PageIndex] = pdf.generate("a")
+			}
+			return pageAnchors[link.PageIndex], true
 		}
-	}
 
-	err = pdf.CreateDefaultFragments(pdfInfo)
-	if err != nil {
-		return err
+		for i, page := range pages {
+			for j, view := range source.Views(page) {
+				err := pdf.AddPage(r, view, source.linkRegions(view, anchor))
+				if err != nil {
+					return err
+				}
+
+				location := pdf.Locations[len(pdf.Locations)-1].Key
+				if i == 0 && j == 0 {
+					r.FirstLocation = location
+				}
+				if j == 0 {
+					pageLocations[page.Index] = location
+					for landmark, index := range source.Landmarks {
+						if index == page.Index {
+							pdf.addLandmark(landmark, location)
+						}
+					}
+				}
+				if j == 0 && page.Index < len(source.PageLabels) && source.PageLabels[page.Index] != "" {
+					pdf.PageList = append(pdf.PageList, KVEid{Key: location, Value: source.PageLabels[page.Index]})
+				}
+			}
+
+			if DEBUG_ONE_PAGE {
+				if i == 0 {
+					break
+				}
+			}
+		}
+
+		targets := []int{}
+		for index := range pageAnchors {
+			targets = append(targets, index)
+		}
+		sort.Ints(targets)
+		for _, index := range targets {
+			location, exists := pageLocations[index]
+			if !exists {
+				// the page was not reached, as when debugging one page
+				location = r.FirstLocation
+			}
+			pdf.Anchors = append(pdf.Anchors, Anchor{
+				AnchorName: pageAnchors[index],
+				Position:   TargetPosition{Id: location},
+			})
+		}
+
+		pdf.Resources = append(pdf.Resources, r)
 	}
 
-	return nil
+	return pdf.CreateDefaultFragments(pdfInfo)
 }
 
-func (pdf *PDF) AddD6(d6 string, path string) error {
-	err := pdf.db.InsertFragmentProperties(d6, "element_type", "auxiliary_data")
+func (pdf *PDF) AddD6(r Resource) error {
+	d6 := r.AuxiliaryData
+	err := pdf.store.InsertFragmentProperties(d6, "element_type", "auxiliary_data")
 	if err != nil {
 		return err
 	}
@@ -120,90 +377,159 @@ func (pdf *PDF) AddD6(d6 string, path string) error {
 			},
 			BMetadata[string]{
 				Key:   "resource_stream",
-				Value: "rsrc8",
+				Value: r.Name,
 			},
 			BMetadata[string]{
 				Key:   "size",
-				Value: "12844",
+				Value: formatInt(r.Info.Size),
 			},
 			BMetadata[string]{
 				Key:   "modified_time",
-				Value: "1725439015",
+				Value: formatInt(clampTime(r.Info.ModifiedTime, pdf.sourceDate)),
 			},
 			BMetadata[string]{
 				Key:   "location",
-				Value: path,
+				Value: r.Location,
 			},
 		},
 	}
 
-	return pdf.db.InsertHashFragments(d6, "blob", v)
+	err = db.InsertHashFragments(pdf.store, d6, "blob", v)
+	if err != nil {
+		return err
+	}
+
+	err = pdf.store.InsertFragmentProperties(r.Name, "element_type", "bcRawMedia")
+	if err != nil {
+		return err
+	}
+	return pdf.store.InsertFragment(r.Name, "path", []byte(r.Location))
 }
 
-func (pdf *PDF) AddE9(e9 string, pageIndex int) error {
-	err := pdf.db.InsertFragmentProperties(e9, "child", pdf.d6)
+func (pdf *PDF) AddE9(e9 string, r Resource, page Page) error {
+	err := pdf.store.InsertFragmentProperties(e9, "child", r.AuxiliaryData)
 	if err != nil {
 		return err
 	}
 
-	err = pdf.db.InsertFragmentProperties(e9, "child", "rsrc8")
+	err = pdf.store.InsertFragmentProperties(e9, "child", r.Name)
 	if err != nil {
 		return err
 	}
 
-	err = pdf.db.InsertFragmentProperties(e9, "element_type", "external_resource")
+	err = pdf.store.InsertFragmentProperties(e9, "element_type", "external_resource")
 	if err != nil {
 		return err
 	}
 
 	v := ExternalSource{
-		MarginLeft: 0,
+		MarginLeft: page.Left,
 		Format: Symbol{
 			Value: "pdf",
 		},
-		MarginBottom: 0,
-		MarginRight:  0.5,
-		PageIndex:    pageIndex,
-		Location:     "rsrc8",
+		MarginBottom: page.Bottom,
+		MarginRight:  page.Right,
+		PageIndex:    page.Index,
+		Location:     r.Name,
 		AuxiliaryData: Kfxid{
-			Id: pdf.d6,
+			Id: r.AuxiliaryData,
 		},
-		ResourceWidth:  596,
-		ResourceHeight: 842,
+		ResourceWidth:  page.Size.Width,
+		ResourceHeight: page.Size.Height,
 		ResourceName: Kfxid{
 			Id: e9,
 		},
-		MarginTop: 0,
+		MarginTop: page.Top,
 	}
 
-	return pdf.db.InsertHashFragments(e9, "blob", v)
+	return db.InsertHashFragments(pdf.store, e9, "blob", v)
+}
+
+// AddCover writes the cover section, showing the image as a single page
+func (pdf *PDF) AddCover(cover Cover) error {
+	pdf.register(cover.Resource)
+	r := Resource{
+		Name:          cover.Resource,
+		AuxiliaryData: pdf.generate("d"),
+		Location:      "res/" + cover.Resource,
+		Info:          cover.Info,
+	}
+	pdf.cover = &r
+
+	return pdf.addSection(float64(cover.Width), float64(cover.Height), nil, func(e9 string) error {
+		pdf.coverImage = e9
+		return pdf.AddCoverImage(e9, r, cover)
+	})
+}
+
+func (pdf *PDF) AddCoverImage(e9 string, r Resource, cover Cover) error {
+	err := pdf.store.InsertFragmentProperties(e9, "child", r.AuxiliaryData)
+	if err != nil {
+		return err
+	}
+
+	err = pdf.store.InsertFragmentProperties(e9, "child", r.Name)
+	if err != nil {
+		return err
+	}
+
+	err = pdf.store.InsertFragmentProperties(e9, "element_type", "external_resource")
+	if err != nil {
+		return err
+	}
+
+	v := ImageResource{
+		Format: Symbol{
+			Value: cover.Format,
+		},
+		Location: r.Name,
+		AuxiliaryData: Kfxid{
+			Id: r.AuxiliaryData,
+		},
+		ResourceWidth:  cover.Width,
+		ResourceHeight: cover.Height,
+		ResourceName: Kfxid{
+			Id: e9,
+		},
+	}
+
+	return db.InsertHashFragments(pdf.store, e9, "blob", v)
+}
+
+// rawMedia lists every resource embedded in the book, cover first
+func (pdf *PDF) rawMedia() []Resource {
+	if pdf.cover == nil {
+		return pdf.Resources
+	}
+	return append([]Resource{*pdf.cover}, pdf.Resources...)
 }
 
 func (pdf *PDF) AddD7(d7 string) error {
-	err := pdf.db.InsertFragmentProperties(d7, "element_type", "auxiliary_data")
+	err := pdf.store.InsertFragmentProperties(d7, "element_type", "auxiliary_data")
 	if err != nil {
 		return err
 	}
 
+	resources := []Ref{}
+	for _, r := range pdf.rawMedia() {
+		resources = append(resources, Ref{Value: r.AuxiliaryData})
+	}
+
 	v := AuxaliaryData{
 		Id: d7,
 		Metadata: []any{
 			BMetadata[[]Ref]{
-				Key: "auxData_resource_list",
-				Value: []Ref{
-					{
-						Value: pdf.d6,
-					},
-				},
+				Key:   "auxData_resource_list",
+				Value: resources,
 			},
 		},
 	}
 
-	return pdf.db.InsertHashFragments(d7, "blob", v)
+	return db.InsertHashFragments(pdf.store, d7, "blob", v)
 }
 
-func (pdf *PDF) AddC0Spm(c0 string, c0spm string, t1 string, t3 string, i4 string, i5 string) error {
-	err := pdf.db.InsertFragmentProperties(c0spm, "element_type", "section_position_id_map")
+func (pdf *PDF) AddC0Spm(c0 string, c0spm string, t1 string, t3 string, i4 string, i5 string, links []string) error {
+	err := pdf.store.InsertFragmentProperties(c0spm, "element_type", "section_position_id_map")
 	if err != nil {
 		return err
 	}
@@ -211,46 +537,49 @@ func (pdf *PDF) AddC0Spm(c0 string, c0spm string, t1 string, t3 string, i4 strin
 	pdf.AddSectionToEidbucket(t1, c0)
 	pdf.AddSectionToEidbucket(t3, c0)
 
-	v := SectionPositionIdMap{
-		Contains: []ValueMap{
-			{
-				ID:        1,
-				Reference: t1,
-			},
-			{
-				ID:        2,
-				Reference: i4,
-			},
-			{
-				ID:        3,
-				Reference: i5,
-			},
-			{
-				ID:        4,
-				Reference: t3,
-			},
+	contains := []ValueMap{
+		{
+			ID:        1,
+			Reference: t1,
+		},
+		{
+			ID:        2,
+			Reference: i4,
+		},
+		{
+			ID:        3,
+			Reference: i5,
 		},
+	}
+	for _, link := range links {
+		contains = append(contains, ValueMap{ID: len(contains) + 1, Reference: link})
+	}
+	contains = append(contains, ValueMap{ID: len(contains) + 1, Reference: t3})
+	pdf.pidCounts[c0] = len(contains)
+
+	v := SectionPositionIdMap{
+		Contains:    contains,
 		SectionName: c0,
 	}
 
-	return pdf.db.InsertHashFragments(c0spm, "blob", v)
+	return db.InsertHashFragments(pdf.store, c0spm, "blob", v)
 }
 
 func (pdf *PDF) AddC0(c0 string, c0AD string, l2 string, t1 string, t3 string) error {
 	pdf.AddSectionToEidbucket(c0, c0)
 	pdf.Sections = append(pdf.Sections, c0)
 
-	err := pdf.db.InsertFragmentProperties(c0, "child", c0AD)
+	err := pdf.store.InsertFragmentProperties(c0, "child", c0AD)
 	if err != nil {
 		return err
 	}
 
-	err = pdf.db.InsertFragmentProperties(c0, "child", l2)
+	err = pdf.store.InsertFragmentProperties(c0, "child", l2)
 	if err != nil {
 		return err
 	}
 
-	err = pdf.db.InsertFragmentProperties(c0, "element_type", "section")
+	err = pdf.store.InsertFragmentProperties(c0, "element_type", "section")
 	if err != nil {
 		return err
 	}
@@ -303,21 +632,22 @@ func (pdf *PDF) AddC0(c0 string, c0AD string, l2 string, t1 string, t3 string) e
 		},
 	}
 
-	return pdf.db.InsertHashFragments(c0, "blob", v)
+	return db.InsertHashFragments(pdf.store, c0, "blob", v)
 }
 
 func (pdf *PDF) AddI5(c0 string, i5 string, e9 string) error {
-	err := pdf.db.InsertFragmentProperties(i5, "child", e9)
+	err := pdf.store.InsertFragmentProperties(i5, "child", e9)
 	if err != nil {
 		return err
 	}
 
-	err = pdf.db.InsertFragmentProperties(i5, "element_type", "structure")
+	err = pdf.store.InsertFragmentProperties(i5, "element_type", "structure")
 	if err != nil {
 		return err
 	}
 
 	pdf.AddSectionToEidbucket(i5, c0)
+	pdf.Locations = append(pdf.Locations, KVEid{Key: i5, Value: c0})
 
 	v := PageTemplateI5{
 		Id: i5,
@@ -341,17 +671,30 @@ func (pdf *PDF) AddI5(c0 string, i5 string, e9 string) error {
 		},
 	}
 
-	return pdf.db.InsertHashFragments(i5, "blob", v)
+	return db.InsertHashFragments(pdf.store, i5, "blob", v)
 
 }
 
-func (pdf *PDF) AddI4(c0 string, i4 string, i5 string) error {
-	err := pdf.db.InsertFragmentProperties(i4, "child", i5)
+func (pdf *PDF) AddI4(c0 string, i4 string, i5 string, links []string, width float64, height float64) error {
+	err := pdf.store.InsertFragmentProperties(i4, "child", i5)
 	if err != nil {
 		return err
 	}
 
-	err = pdf.db.InsertFragmentProperties(i4, "element_type", "structure")
+	contentList := []Kfxid{
+		{
+			Id: i5,
+		},
+	}
+	for _, link := range links {
+		err = pdf.store.InsertFragmentProperties(i4, "child", link)
+		if err != nil {
+			return err
+		}
+		contentList = append(contentList, Kfxid{Id: link})
+	}
+
+	err = pdf.store.InsertFragmentProperties(i4, "element_type", "structure")
 	if err != nil {
 		return err
 	}
@@ -360,8 +703,8 @@ func (pdf *PDF) AddI4(c0 string, i4 string, i5 string) error {
 
 	v := PageTemplateI4{
 		Id:          i4,
-		FixedWidth:  59600,
-		FixedHeight: 84200,
+		FixedWidth:  int(math.Round(width * 100)),
+		FixedHeight: int(math.Round(height * 100)),
 		FitText: Symbol{
 			Value: "force",
 		},
@@ -374,28 +717,24 @@ func (pdf *PDF) AddI4(c0 string, i4 string, i5 string) error {
 		Type: Symbol{
 			Value: "container",
 		},
-		ContentList: []Kfxid{
-			{
-				Id: i5,
-			},
-		},
+		ContentList: contentList,
 	}
 
-	return pdf.db.InsertHashFragments(i4, "blob", v)
+	return db.InsertHashFragments(pdf.store, i4, "blob", v)
 }
 
 func (pdf *PDF) AddL2(l2 string, i4 string) error {
-	err := pdf.db.InsertFragmentProperties(l2, "child", l2)
+	err := pdf.store.InsertFragmentProperties(l2, "child", l2)
 	if err != nil {
 		return err
 	}
 
-	err = pdf.db.InsertFragmentProperties(l2, "child", i4)
+	err = pdf.store.InsertFragmentProperties(l2, "child", i4)
 	if err != nil {
 		return err
 	}
 
-	err = pdf.db.InsertFragmentProperties(l2, "element_type", "storyline")
+	err = pdf.store.InsertFragmentProperties(l2, "element_type", "storyline")
 	if err != nil {
 		return err
 	}
@@ -411,11 +750,11 @@ func (pdf *PDF) AddL2(l2 string, i4 string) error {
 		},
 	}
 
-	return pdf.db.InsertHashFragments(l2, "blob", v)
+	return db.InsertHashFragments(pdf.store, l2, "blob", v)
 }
 
 func (pdf *PDF) AddC0AD(c0AD string) error {
-	err := pdf.db.InsertFragmentProperties(c0AD, "element_type", "auxiliary_data")
+	err := pdf.store.InsertFragmentProperties(c0AD, "element_type", "auxiliary_data")
 	if err != nil {
 		return err
 	}
@@ -430,24 +769,36 @@ func (pdf *PDF) AddC0AD(c0AD string) error {
 		},
 	}
 
-	return pdf.db.InsertHashFragments(c0AD, "blob", v)
+	return db.InsertHashFragments(pdf.store, c0AD, "blob", v)
 }
 
-func (pdf *PDF) AddPage(i int) error {
+func (pdf *PDF) AddPage(r Resource, page Page, links []linkRegion) error {
+	return pdf.addSection(page.Width(), page.Height(), links, func(e9 string) error {
+		return pdf.AddE9(e9, r, page)
+	})
+}
+
+// addSection writes a section holding a single image and the links shown
+// over it, the external resource of the image being written by addResource
+func (pdf *PDF) addSection(width float64, height float64, links []linkRegion, addResource func(e9 string) error) error {
 	// c0
-	c0 := generator.Generate("c")
+	c0 := pdf.generate("c")
 	c0AD := c0 + "-ad"
 	c0spm := c0 + "-spm"
-	generator.Register(c0spm)
-	generator.Register(c0AD)
-	l2 := generator.Generate("l")
-	e9 := generator.Generate("e")
-	i4 := generator.Generate("i")
-	i5 := generator.Generate("i")
+	pdf.register(c0spm, c0AD)
+	l2 := pdf.generate("l")
+	e9 := pdf.generate("e")
+	i4 := pdf.generate("i")
+	i5 := pdf.generate("i")
 
-	t1 := generator.Generate("t")
+	t1 := pdf.generate("t")
 
-	t3 := generator.Generate("t")
+	t3 := pdf.generate("t")
+
+	linkIds := []string{}
+	for range links {
+		linkIds = append(linkIds, pdf.generate("i"))
+	}
 
 	if DEBUG_ONE_PAGE {
 		t1 = "t1"
@@ -459,6 +810,7 @@ func (pdf *PDF) AddPage(i int) error {
 		t3 = "t3"
 		c0AD = c0 + "-ad"
 		c0spm = c0 + "-spm"
+		pdf.register(t1, i5, i4, l2, c0, e9, t3, c0AD, c0spm)
 	}
 
 	err := pdf.AddC0(c0, c0AD, l2, t1, t3)
@@ -471,12 +823,12 @@ func (pdf *PDF) AddPage(i int) error {
 		return err
 	}
 
-	err = pdf.AddC0Spm(c0, c0spm, t1, t3, i4, i5)
+	err = pdf.AddC0Spm(c0, c0spm, t1, t3, i4, i5, linkIds)
 	if err != nil {
 		return err
 	}
 
-	err = pdf.AddE9(e9, i)
+	err = addResource(e9)
 	if err != nil {
 		return err
 	}
@@ -486,7 +838,14 @@ func (pdf *PDF) AddPage(i int) error {
 		return err
 	}
 
-	err = pdf.AddI4(c0, i4, i5)
+	for k, link := range links {
+		err = pdf.AddLink(c0, linkIds[k], link)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = pdf.AddI4(c0, i4, i5, linkIds, width, height)
 	if err != nil {
 		return err
 	}
@@ -499,8 +858,65 @@ func (pdf *PDF) AddPage(i int) error {
 	return nil
 }
 
+// AddLink writes a clickable region of a page pointing at an anchor
+func (pdf *PDF) AddLink(c0 string, id string, link linkRegion) error {
+	err := pdf.store.InsertFragmentProperties(id, "child", link.anchor)
+	if err != nil {
+		return err
+	}
+
+	err = pdf.store.InsertFragmentProperties(id, "element_type", "structure")
+	if err != nil {
+		return err
+	}
+
+	pdf.AddSectionToEidbucket(id, c0)
+
+	v := PageLink{
+		Id: id,
+		Type: Symbol{
+			Value: "container",
+		},
+		Top:         link.top,
+		Left:        link.left,
+		FixedWidth:  link.width,
+		FixedHeight: link.height,
+		LinkTo:      link.anchor,
+	}
+
+	return db.InsertHashFragments(pdf.store, id, "blob", v)
+}
+
+// uriAnchor returns the anchor of an external link target, the same one for
+// every link to a uri
+func (pdf *PDF) uriAnchor(uri string) string {
+	if name, exists := pdf.uriAnchors[uri]; exists {
+		return name
+	}
+	name := pdf.generate("a")
+	pdf.uriAnchors[uri] = name
+	pdf.Anchors = append(pdf.Anchors, Anchor{AnchorName: name, Uri: uri})
+	return name
+}
+
+// AddAnchors writes the targets of the links
+func (pdf *PDF) AddAnchors() error {
+	for _, anchor := range pdf.Anchors {
+		err := pdf.store.InsertFragmentProperties(anchor.AnchorName, "element_type", "anchor")
+		if err != nil {
+			return err
+		}
+
+		err = db.InsertHashFragments(pdf.store, anchor.AnchorName, "blob", anchor)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (pdf *PDF) AddMetadata() error {
-	err := pdf.db.InsertFragmentProperties("metadata", "element_type", "metadata")
+	err := pdf.store.InsertFragmentProperties("metadata", "element_type", "metadata")
 	if err != nil {
 		return err
 	}
@@ -522,22 +938,36 @@ func (pdf *PDF) AddMetadata() error {
 		},
 	}
 
-	return pdf.db.InsertHashFragments("metadata", "blob", v)
+	return db.InsertHashFragments(pdf.store, "metadata", "blob", v)
 }
 
 func (pdf *PDF) AddMaxId() error {
-	err := pdf.db.InsertFragmentProperties("max_id", "element_type", "max_id")
+	err := pdf.store.InsertFragmentProperties("max_id", "element_type", "max_id")
 	if err != nil {
 		return err
 	}
 	maxId := MaxID{
-		Value: 834,
+		Value: pdf.maxId(),
 	}
-	return pdf.db.InsertHashFragments("max_id", "blob", maxId)
+	return db.InsertHashFragments(pdf.store, "max_id", "blob", maxId)
+}
+
+// eidBlocks returns the blocks of the eid buckets in order, so the fragments
+// don't depend on map iteration
+func (pdf *PDF) eidBlocks() []int {
+	blocks := []int{}
+	for block := range pdf.Eidbuckets {
+		blocks = append(blocks, block)
+	}
+	sort.Ints(blocks)
+	return blocks
 }
 
 func (pdf *PDF) AddEidBuckets() error {
-	for id, els := range pdf.Eidbuckets {
+	for _, id := range pdf.eidBlocks() {
+		els := pdf.Eidbuckets[id]
+		pdf.register("eidbucket_" + strconv.Itoa(id))
+
 		contains := []ContainsElement{}
 		for _, v := range els {
 			contains = append(contains, ContainsElement{Eid: v.Key, SectionName: v.Value})
@@ -548,12 +978,12 @@ func (pdf *PDF) AddEidBuckets() error {
 			Contains: contains,
 		}
 
-		err := pdf.db.InsertHashFragments("eidbucket_"+strconv.Itoa(id), "blob", v)
+		err := db.InsertHashFragments(pdf.store, "eidbucket_"+strconv.Itoa(id), "blob", v)
 		if err != nil {
 			return err
 		}
 
-		err = pdf.db.InsertFragmentProperties("eidbucket_"+strconv.Itoa(id), "element_type", "yj.eidhash_eid_section_map")
+		err = pdf.store.InsertFragmentProperties("eidbucket_"+strconv.Itoa(id), "element_type", "yj.eidhash_eid_section_map")
 		if err != nil {
 			return err
 		}
@@ -562,12 +992,12 @@ func (pdf *PDF) AddEidBuckets() error {
 }
 
 func (pdf *PDF) AddRoot() error {
-	err := pdf.db.InsertFragmentProperties("$ion_symbol_table", "element_type", "$ion_symbol_table")
+	err := pdf.store.InsertFragmentProperties("$ion_symbol_table", "element_type", "$ion_symbol_table")
 	if err != nil {
 		return err
 	}
 	bytesIon, _ := hex.DecodeString(ion_symbol_table)
-	return pdf.db.InsertFragment("$ion_symbol_table", "blob", bytesIon)
+	return pdf.store.InsertFragment("$ion_symbol_table", "blob", bytesIon)
 }
 
 func (pdf *PDF) CreateDefaultFragments(pdfInfo PDFInfo) error {
@@ -586,56 +1016,187 @@ func (pdf *PDF) CreateDefaultFragments(pdfInfo PDFInfo) error {
 		return err
 	}
 
-	err = pdf.AddDocumentData()
+	for _, r := range pdf.rawMedia() {
+		err = pdf.AddD6(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = pdf.AddD7(pdf.d7)
 	if err != nil {
 		return err
 	}
 
-	err = pdf.AddD6(pdf.d6, pdfInfo.Path)
+	err = pdf.AddAnchors()
 	if err != nil {
 		return err
 	}
 
-	err = pdf.AddD7(pdf.d7)
+	err = pdf.AddMetadata()
 	if err != nil {
 		return err
 	}
 
-	err = pdf.AddMaxId()
+	err = pdf.AddSectionPidCountMap()
 	if err != nil {
 		return err
 	}
 
-	err = pdf.AddMetadata()
+	err = pdf.AddEidBuckets()
 	if err != nil {
 		return err
 	}
 
-	err = pdf.AddSectionPidCountMap()
+	err = pdf.AddLocationMap()
 	if err != nil {
 		return err
 	}
 
-	err = pdf.db.InsertFragmentProperties("rsrc8", "element_type", "bcRawMedia")
+	err = pdf.AddContentFeatures()
 	if err != nil {
 		return err
 	}
-	err = pdf.db.InsertFragment("rsrc8", "path", []byte(pdfInfo.Path))
+
+	err = pdf.AddKfxidEidMap()
 	if err != nil {
 		return err
 	}
 
-	err = pdf.AddEidBuckets()
+	err = pdf.AddRootEntity()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// max_id is written last, once every id of the book is known
+	err = pdf.AddDocumentData(pdfInfo.Direction)
+	if err != nil {
+		return err
+	}
+
+	return pdf.AddMaxId()
+}
+
+// AddLocationMap writes one location per page, pointing at the page image
+func (pdf *PDF) AddLocationMap() error {
+	err := pdf.store.InsertFragmentProperties("location_map", "element_type", "location_map")
+	if err != nil {
+		return err
+	}
+
+	locations := []Location{}
+	for _, v := range pdf.Locations {
+		err = pdf.store.InsertFragmentProperties("location_map", "child", v.Value)
+		if err != nil {
+			return err
+		}
+
+		locations = append(locations, Location{Id: v.Key, Offset: 0})
+	}
+
+	v := LocationMaps{
+		LocationMaps: []LocationMap{
+			{
+				Locations: locations,
+			},
+		},
+	}
+
+	return db.InsertHashFragments(pdf.store, "location_map", "blob", v)
+}
+
+func (pdf *PDF) AddContentFeatures() error {
+	err := pdf.store.InsertFragmentProperties("content_features", "element_type", "content_features")
+	if err != nil {
+		return err
+	}
+
+	v := ContentFeatures{
+		Id: Symbol{
+			Value: "content_features",
+		},
+		Features: []Feature{
+			{
+				Namespace: "SDK.Marker",
+				Key:       "CanonicalFormat",
+				VersionInfo: VersionInfo{
+					Version: Version{MajorVersion: 1, MinorVersion: 0},
+				},
+			},
+			{
+				Namespace: "com.amazon.yjconversion",
+				Key:       "yj_pdf_support",
+				VersionInfo: VersionInfo{
+					Version: Version{MajorVersion: 1, MinorVersion: 0},
+				},
+			},
+		},
+	}
+
+	return db.InsertHashFragments(pdf.store, "content_features", "blob", v)
+}
+
+// AddKfxidEidMap numbers every eid tracked in the eid buckets, in block order
+func (pdf *PDF) AddKfxidEidMap() error {
+	err := pdf.store.InsertFragmentProperties("yj.kfxid_eid_map", "element_type", "yj.kfxid_eid_map")
+	if err != nil {
+		return err
+	}
+
+	contains := []KfxidEid{}
+	for _, block := range pdf.eidBlocks() {
+		for _, v := range pdf.Eidbuckets[block] {
+			contains = append(contains, KfxidEid{Id: v.Key, Eid: len(contains) + 1})
+		}
+	}
+
+	v := KfxidEidMap{
+		Contains: contains,
+	}
+
+	return db.InsertHashFragments(pdf.store, "yj.kfxid_eid_map", "blob", v)
+}
+
+// AddRootEntity lists the top level fragments of the book
+func (pdf *PDF) AddRootEntity() error {
+	pdf.register("root_entity")
+	err := pdf.store.InsertFragmentProperties("root_entity", "element_type", "root_entity")
+	if err != nil {
+		return err
+	}
+
+	roots := []string{
+		"book_metadata",
+		"book_navigation",
+		"content_features",
+		"document_data",
+		"location_map",
+		"max_id",
+		"metadata",
+		"yj.kfxid_eid_map",
+		"yj.section_pid_count_map",
+	}
+
+	contains := []Kfxid{}
+	for _, root := range roots {
+		err = pdf.store.InsertFragmentProperties("root_entity", "child", root)
+		if err != nil {
+			return err
+		}
+
+		contains = append(contains, Kfxid{Id: root})
+	}
+
+	v := RootEntity{
+		Contains: contains,
+	}
+
+	return db.InsertHashFragments(pdf.store, "root_entity", "blob", v)
 }
 
 func (pdf *PDF) AddSectionPidCountMap() error {
 
-	err := pdf.db.InsertFragmentProperties("yj.section_pid_count_map", "element_type", "yj.section_pid_count_map")
+	err := pdf.store.InsertFragmentProperties("yj.section_pid_count_map", "element_type", "yj.section_pid_count_map")
 	if err != nil {
 		return err
 	}
@@ -644,7 +1205,7 @@ func (pdf *PDF) AddSectionPidCountMap() error {
 	for _, v := range pdf.Sections {
 		contains = append(contains, YJContains{
 			SectionName: v,
-			Length:      4,
+			Length:      pdf.pidCounts[v],
 		})
 	}
 
@@ -652,16 +1213,16 @@ func (pdf *PDF) AddSectionPidCountMap() error {
 		Contains: contains,
 	}
 
-	return pdf.db.InsertHashFragments("yj.section_pid_count_map", "blob", v)
+	return db.InsertHashFragments(pdf.store, "yj.section_pid_count_map", "blob", v)
 }
 
-func (pdf *PDF) AddDocumentData() error {
-	err := pdf.db.InsertFragmentProperties("document_data", "element_type", "document_data")
+func (pdf *PDF) AddDocumentData(direction Direction) error {
+	err := pdf.store.InsertFragmentProperties("document_data", "element_type", "document_data")
 	if err != nil {
 		return err
 	}
 
-	err = pdf.db.InsertFragmentProperties("document_data", "child", pdf.d7)
+	err = pdf.store.InsertFragmentProperties("document_data", "child", pdf.d7)
 	if err != nil {
 		return err
 	}
@@ -672,9 +1233,9 @@ func (pdf *PDF) AddDocumentData() error {
 	}
 
 	v := DocumentData{
-		MaxId: generator.GetSize(),
+		MaxId: pdf.maxId(),
 		Direction: Symbol{
-			Value: "ltr",
+			Value: string(DirectionLTR),
 		},
 		PanZoom: Symbol{
 			Value: "enabled",
@@ -692,44 +1253,91 @@ func (pdf *PDF) AddDocumentData() error {
 		},
 	}
 
-	return pdf.db.InsertHashFragments("document_data", "blob", v)
+	if direction == DirectionRTL {
+		v.Direction.Value = string(DirectionRTL)
+		v.PageProgressionDirection.Value = string(DirectionRTL)
+	}
+
+	return db.InsertHashFragments(pdf.store, "document_data", "blob", v)
 }
 
 func (pdf *PDF) AddBookNavigation() error {
-	err := pdf.db.InsertFragmentProperties("book_navigation", "element_type", "book_navigation")
+	err := pdf.store.InsertFragmentProperties("book_navigation", "element_type", "book_navigation")
 	if err != nil {
 		return err
 	}
 
+	// merged books get one entry per source
+	entries := []NavUnit{}
+	if len(pdf.Resources) > 1 {
+		for _, r := range pdf.Resources {
+			entries = append(entries, NavUnit{
+				Representation: Representation{
+					Label: r.Title,
+				},
+				TargetPosition: TargetPosition{
+					Id: r.FirstLocation,
+				},
+			})
+		}
+	}
+
+	pdf.register("nA")
+	containers := []NavContainer{
+		{
+			NavType:          "toc",
+			NavContainerName: "nA",
+			Entries:          entries,
+		},
+	}
+
+	// the printed page numbers, when the pdf has page labels
+	if len(pdf.PageList) > 0 {
+		pages := []NavUnit{}
+		for _, kv := range pdf.PageList {
+			pages = append(pages, NavUnit{
+				Representation: Representation{
+					Label: kv.Value,
+				},
+				TargetPosition: TargetPosition{
+					Id: kv.Key,
+				},
+			})
+		}
+		pdf.register("nB")
+		containers = append(containers, NavContainer{
+			NavType:          "page_list",
+			NavContainerName: "nB",
+			Entries:          pages,
+		})
+	}
+
+	pdf.register("nC")
+	containers = append(containers, NavContainer{
+		NavType:          "landmarks",
+		NavContainerName: "nC",
+		Entries:          pdf.landmarkEntries(),
+	})
+
 	bn := BookNavigations{
 		BookNavigations: []BookNavigation{
 			{
 				ReadingOrderName: "default",
-				NavContainers: []NavContainer{
-					{
-						NavType:          "toc",
-						NavContainerName: "nA",
-						Entries:          []string{},
-					},
-				},
+				NavContainers:    containers,
 			},
 		},
 	}
 
-	return pdf.db.InsertHashFragments("book_navigation", "blob", bn)
+	return db.InsertHashFragments(pdf.store, "book_navigation", "blob", bn)
 }
 
 func (pdf *PDF) AddBookMetadata(title string, autor string) error {
-	err := pdf.db.InsertFragmentProperties("book_metadata", "element_type", "book_metadata")
+	err := pdf.store.InsertFragmentProperties("book_metadata", "element_type", "book_metadata")
 	if err != nil {
 		return err
 	}
 
-	myuuid, err := uuid.NewUUID()
-	if err != nil {
-		return err
-	}
-	myuuidstr := myuuid.String()
+	myuuidstr := pdf.bookId
 
 	if DEBUG_ONE_PAGE {
 		myuuidstr = "dNdrKhVjR26t_cZ_uHYkOA0"
@@ -737,20 +1345,28 @@ func (pdf *PDF) AddBookMetadata(title string, autor string) error {
 		autor = "KC"
 	}
 
+	titleMetadata := []any{
+		BMetadata[string]{
+			Key:   "book_id",
+			Value: myuuidstr,
+		},
+		BMetadata[string]{
+			Key:   "title",
+			Value: title,
+		},
+	}
+	if pdf.coverImage != "" {
+		titleMetadata = append(titleMetadata, BMetadata[string]{
+			Key:   "cover_image",
+			Value: pdf.coverImage,
+		})
+	}
+
 	bm := BookMetadata{
 		CatagoerisedMetadata: []CategorisedMetadata{
 			{
 				Category: "kindle_title_metadata",
-				Metadata: []any{
-					BMetadata[string]{
-						Key:   "book_id",
-						Value: myuuidstr,
-					},
-					BMetadata[string]{
-						Key:   "title",
-						Value: title,
-					},
-				},
+				Metadata: titleMetadata,
 			},
 			{
 				Category: "kindle_capability_metadata",
@@ -793,5 +1409,5 @@ func (pdf *PDF) AddBookMetadata(title string, autor string) error {
 			},
 		},
 	}
-	return pdf.db.InsertHashFragments("book_metadata", "blob", bm)
+	return db.InsertHashFragments(pdf.store, "book_metadata", "blob", bm)
 }
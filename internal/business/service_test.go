@@ -0,0 +1,499 @@
+package business
+
+import (
+	"path"
+	"pdf_raw_printing/internal/libs/db"
+	"pdf_raw_printing/internal/libs/ionreader"
+	"pdf_raw_printing/internal/libs/wion"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// buildInMemory builds a book of the given number of pages without touching
+// the filesystem
+func buildInMemory(t *testing.T, pdfInfo PDFInfo) (*PDF, *db.MemoryStore) {
+	store := db.NewMemoryStore()
+	pdf := NewPdf(store)
+	require.NoError(t, pdf.Build(pdfInfo))
+	return pdf, store
+}
+
+func TestBuildGraph(t *testing.T) {
+	pdf, store := buildInMemory(t, PDFInfo{
+		Title: "title",
+		Autor: "author",
+		Sources: []Source{
+			{Path: "a.pdf", Resource: ResourceName(0), NumberOfPages: 3},
+		},
+	})
+
+	require.Len(t, pdf.Sections, 3)
+
+	fragments := map[string]bool{}
+	require.NoError(t, store.Fragments(func(f db.Fragment) error {
+		fragments[f.Id] = true
+		return nil
+	}))
+
+	elementTypes := map[string]string{}
+	require.NoError(t, store.FragmentProperties(func(p db.FragmentProperty) error {
+		switch p.Key {
+		case "element_type":
+			elementTypes[p.Id] = p.Value
+		case "child":
+			require.True(t, fragments[p.Value], "%s child %s is missing", p.Id, p.Value)
+		}
+		return nil
+	}))
+
+	for id := range fragments {
+		require.NotEmpty(t, elementTypes[id], "%s has no element_type", id)
+	}
+
+	for _, section := range pdf.Sections {
+		require.Equal(t, "section", elementTypes[section])
+		require.Equal(t, "section_position_id_map", elementTypes[section+"-spm"])
+	}
+}
+
+func TestValidate(t *testing.T) {
+	_, store := buildInMemory(t, PDFInfo{
+		Title: "title",
+		Autor: "author",
+		Sources: []Source{
+			{Path: "a.pdf", Resource: ResourceName(0), NumberOfPages: 2},
+		},
+	})
+	require.NoError(t, Validate(store))
+
+	// a page image pointing to a missing external resource
+	require.NoError(t, store.InsertFragmentProperties("iBroken", "element_type", "structure"))
+	require.NoError(t, db.InsertHashFragments(store, "iBroken", "blob", PageTemplateI5{
+		Id:           "iBroken",
+		Width:        Width{Value: 100, Unit: Symbol{Value: "percent"}},
+		Height:       Width{Value: 100, Unit: Symbol{Value: "percent"}},
+		Type:         Symbol{Value: "image"},
+		ResourceName: Kfxid{Id: "eMissing"},
+	}))
+
+	// a section outside of the reading orders, without eids nor pid count
+	require.NoError(t, store.InsertFragmentProperties("cOrphan", "element_type", "section"))
+	require.NoError(t, store.InsertFragment("cOrphan", "blob", []byte{}))
+	require.NoError(t, store.InsertFragmentProperties("cOrphan-spm", "element_type", "section_position_id_map"))
+	require.NoError(t, db.InsertHashFragments(store, "cOrphan-spm", "blob", SectionPositionIdMap{
+		SectionName: "cOrphan",
+		Contains:    []ValueMap{{ID: 1, Reference: "iBroken"}},
+	}))
+
+	// a fragment without element_type
+	require.NoError(t, store.InsertFragment("untyped", "blob", []byte{}))
+
+	err := Validate(store)
+	require.Error(t, err)
+	for _, problem := range []string{
+		"fragment iBroken references missing kfx_id eMissing",
+		"section cOrphan is missing from document_data reading orders",
+		"section cOrphan is missing from metadata reading orders",
+		"eid cOrphan is missing from eidbucket_",
+		"eid iBroken is missing from eidbucket_",
+		"section cOrphan has no pid count",
+		"fragment untyped has no element_type",
+	} {
+		require.Contains(t, err.Error(), problem)
+	}
+}
+
+func TestBuildMerged(t *testing.T) {
+	pdf, store := buildInMemory(t, PDFInfo{
+		Title: "title",
+		Autor: "author",
+		Sources: []Source{
+			{Path: "a.pdf", Resource: ResourceName(0), Title: "first", NumberOfPages: 2},
+			{Path: "b.pdf", Resource: ResourceName(1), Title: "second", NumberOfPages: 3, Pages: []int{1, 2}},
+		},
+	})
+	require.NoError(t, Validate(store))
+	require.Len(t, pdf.Sections, 4)
+	require.Len(t, pdf.Resources, 2)
+	require.Equal(t, pdf.Locations[0].Key, pdf.Resources[0].FirstLocation)
+	require.Equal(t, pdf.Locations[2].Key, pdf.Resources[1].FirstLocation)
+
+	rawMedia := map[string]string{}
+	labels := []string{}
+	targets := []string{}
+	require.NoError(t, store.Fragments(func(f db.Fragment) error {
+		if f.PayloadType == "path" {
+			rawMedia[f.Id] = string(f.PayloadValue)
+		}
+		if f.Id == "book_navigation" {
+			values, err := ionreader.Decode(f.PayloadValue)
+			require.NoError(t, err)
+			for _, v := range values {
+				v.Walk(func(v *ionreader.Value) {
+					if v.HasAnnotation("nav_unit") && v.Field("landmark_type") == nil {
+						labels = append(labels, v.Field("representation").Field("label").GetText())
+						targets = append(targets, v.Field("target_position").Field("id").GetText())
+					}
+				})
+			}
+		}
+		return nil
+	}))
+	require.Equal(t, map[string]string{"rsrc1": "res/rsrc1", "rsrc2": "res/rsrc2"}, rawMedia)
+	require.Equal(t, []string{"first", "second"}, labels)
+	require.Equal(t, []string{pdf.Resources[0].FirstLocation, pdf.Resources[1].FirstLocation}, targets)
+}
+
+func TestBuildCover(t *testing.T) {
+	pdf, store := buildInMemory(t, PDFInfo{
+		Title: "title",
+		Autor: "author",
+		Sources: []Source{
+			{Path: "a.pdf", Resource: ResourceName(0), NumberOfPages: 2},
+		},
+		Cover: &Cover{Path: "cover.jpg", Resource: ResourceName(1), Format: "jpg", Width: 600, Height: 800},
+	})
+	require.NoError(t, Validate(store))
+	require.Len(t, pdf.Sections, 3)
+	require.NotEmpty(t, pdf.coverImage)
+	// the cover is the first location, the pdf starts right after it
+	require.Equal(t, pdf.Locations[1].Key, pdf.Resources[0].FirstLocation)
+
+	coverImage := ""
+	format := ""
+	require.NoError(t, store.Fragments(func(f db.Fragment) error {
+		values, err := ionreader.Decode(f.PayloadValue)
+		if f.PayloadType != "blob" || err != nil {
+			return nil
+		}
+		for _, v := range values {
+			v.Walk(func(v *ionreader.Value) {
+				if v.Field("key").GetText() == "cover_image" {
+					coverImage = v.Field("value").GetText()
+				}
+			})
+			if f.Id == pdf.coverImage {
+				format = v.Field("format").GetText()
+			}
+		}
+		return nil
+	}))
+	require.Equal(t, pdf.coverImage, coverImage)
+	require.Equal(t, "jpg", format)
+}
+
+func TestBuildSplit(t *testing.T) {
+	pdf, store := buildInMemory(t, PDFInfo{
+		Title: "title",
+		Autor: "author",
+		Sources: []Source{
+			{Path: "a.pdf", Resource: ResourceName(0), NumberOfPages: 2, Split: Split{Rows: 2, Columns: 2}},
+		},
+	})
+	require.NoError(t, Validate(store))
+	require.Len(t, pdf.Sections, 8)
+	require.Equal(t, pdf.Locations[0].Key, pdf.Resources[0].FirstLocation)
+}
+
+func TestBuildRTL(t *testing.T) {
+	pdf, store := buildInMemory(t, PDFInfo{
+		Title:     "title",
+		Autor:     "author",
+		Direction: DirectionRTL,
+		Sources: []Source{
+			{Path: "a.pdf", Resource: ResourceName(0), NumberOfPages: 1, Split: Split{Rows: 1, Columns: 2}},
+		},
+	})
+	require.NoError(t, Validate(store))
+	require.Len(t, pdf.Sections, 2)
+
+	direction := ""
+	progression := ""
+	leftMargins := []float64{}
+	require.NoError(t, store.Fragments(func(f db.Fragment) error {
+		values, err := ionreader.Decode(f.PayloadValue)
+		if f.PayloadType != "blob" || err != nil {
+			return nil
+		}
+		for _, v := range values {
+			if v.HasAnnotation("document_data") {
+				direction = v.Field("direction").GetText()
+				progression = v.Field("page_progression_direction").GetText()
+			}
+			if v.HasAnnotation("external_resource") {
+				leftMargins = append(leftMargins, v.Field("margin_left").Float)
+			}
+		}
+		return nil
+	}))
+	require.Equal(t, "rtl", direction)
+	require.Equal(t, "rtl", progression)
+	// the right half comes first
+	require.Len(t, leftMargins, 2)
+	require.Greater(t, leftMargins[0], leftMargins[1])
+}
+
+func TestBuildPageList(t *testing.T) {
+	pdf, store := buildInMemory(t, PDFInfo{
+		Title: "title",
+		Autor: "author",
+		Sources: []Source{
+			{
+				Path:          "a.pdf",
+				Resource:      ResourceName(0),
+				NumberOfPages: 4,
+				Pages:         []int{1, 2, 3},
+				Split:         Split{Rows: 2, Columns: 1},
+				PageLabels:    []string{"iii", "iv", "", "1"},
+			},
+		},
+	})
+	require.NoError(t, Validate(store))
+	require.Len(t, pdf.Sections, 6)
+
+	navTypes := []string{}
+	labels := []string{}
+	targets := []string{}
+	require.NoError(t, store.Fragments(func(f db.Fragment) error {
+		if f.Id != "book_navigation" {
+			return nil
+		}
+		values, err := ionreader.Decode(f.PayloadValue)
+		require.NoError(t, err)
+		for _, v := range values {
+			v.Walk(func(v *ionreader.Value) {
+				if !v.HasAnnotation("nav_container") {
+					return
+				}
+				navType := v.Field("nav_type").GetText()
+				navTypes = append(navTypes, navType)
+				if navType != "page_list" {
+					return
+				}
+				v.Walk(func(v *ionreader.Value) {
+					if v.HasAnnotation("nav_unit") {
+						labels = append(labels, v.Field("representation").Field("label").GetText())
+						targets = append(targets, v.Field("target_position").Field("id").GetText())
+					}
+				})
+			})
+		}
+		return nil
+	}))
+	require.Equal(t, []string{"toc", "page_list", "landmarks"}, navTypes)
+	// the unlabelled page is skipped, each label points at the first view
+	require.Equal(t, []string{"iv", "1"}, labels)
+	require.Equal(t, []string{pdf.Locations[0].Key, pdf.Locations[4].Key}, targets)
+}
+
+func TestBuildLinks(t *testing.T) {
+	pdf, store := buildInMemory(t, PDFInfo{
+		Title: "title",
+		Autor: "author",
+		Sources: []Source{
+			{
+				Path:          "a.pdf",
+				Resource:      ResourceName(0),
+				NumberOfPages: 3,
+				Pages:         []int{0, 1},
+				Links: [][]Link{
+					{
+						{Bounds: Bounds{100, 100, 200, 150}, PageIndex: 1},
+						{Bounds: Bounds{100, 200, 200, 250}, PageIndex: 2},
+						{Bounds: Bounds{100, 300, 200, 350}, PageIndex: -1, URI: "https://example.com/"},
+					},
+					{
+						{Bounds: Bounds{100, 100, 200, 150}, PageIndex: -1, URI: "https://example.com/"},
+						{Bounds: Bounds{100, 200, 200, 250}, PageIndex: 0},
+						{Bounds: Bounds{100, 300, 200, 350}, PageIndex: -1},
+					},
+				},
+			},
+		},
+	})
+	require.NoError(t, Validate(store))
+	require.Len(t, pdf.Sections, 2)
+
+	anchors := map[string]string{}
+	linkTo := []string{}
+	pidCounts := []int64{}
+	require.NoError(t, store.Fragments(func(f db.Fragment) error {
+		values, err := ionreader.Decode(f.PayloadValue)
+		if f.PayloadType != "blob" || err != nil {
+			return nil
+		}
+		for _, v := range values {
+			if v.HasAnnotation("anchor") {
+				target := v.Field("uri").GetText()
+				if target == "" {
+					target = v.Field("position").Field("id").GetText()
+				}
+				anchors[v.Field("anchor_name").GetText()] = target
+			}
+			if link := v.Field("link_to"); link != nil {
+				linkTo = append(linkTo, link.GetText())
+			}
+			if v.HasAnnotation("yj.section_pid_count_map") {
+				for _, el := range v.Field("contains").GetChildren() {
+					pidCounts = append(pidCounts, el.Field("length").GetInt())
+				}
+			}
+		}
+		return nil
+	}))
+
+	// the link to the page left out and the link without a target are
+	// dropped, both links to the uri share an anchor
+	require.Len(t, linkTo, 4)
+	targets := []string{}
+	for _, name := range linkTo {
+		targets = append(targets, anchors[name])
+	}
+	require.ElementsMatch(t, []string{
+		pdf.Locations[1].Key,
+		"https://example.com/",
+		"https://example.com/",
+		pdf.Locations[0].Key,
+	}, targets)
+	require.Len(t, anchors, 3)
+	require.Equal(t, []int64{6, 6}, pidCounts)
+}
+
+func TestBuildLandmarks(t *testing.T) {
+	landmarks := func(info PDFInfo) (*PDF, map[string]string) {
+		pdf, store := buildInMemory(t, info)
+		require.NoError(t, Validate(store))
+
+		landmarks := map[string]string{}
+		require.NoError(t, store.Fragments(func(f db.Fragment) error {
+			if f.Id != "book_navigation" {
+				return nil
+			}
+			values, err := ionreader.Decode(f.PayloadValue)
+			require.NoError(t, err)
+			for _, v := range values {
+				v.Walk(func(v *ionreader.Value) {
+					if landmark := v.Field("landmark_type"); v.HasAnnotation("nav_unit") && landmark != nil {
+						landmarks[landmark.GetText()] = v.Field("target_position").Field("id").GetText()
+					}
+				})
+			}
+			return nil
+		}))
+		return pdf, landmarks
+	}
+
+	// the book starts at its first page by default
+	pdf, marks := landmarks(PDFInfo{
+		Title:   "title",
+		Autor:   "author",
+		Sources: []Source{{Path: "a.pdf", Resource: ResourceName(0), NumberOfPages: 3}},
+	})
+	require.Equal(t, map[string]string{
+		"srl":        pdf.Locations[0].Key,
+		"bodymatter": pdf.Locations[0].Key,
+	}, marks)
+
+	// the cover image wins over the cover page
+	pdf, marks = landmarks(PDFInfo{
+		Title: "title",
+		Autor: "author",
+		Sources: []Source{
+			{
+				Path:          "a.pdf",
+				Resource:      ResourceName(0),
+				NumberOfPages: 4,
+				Landmarks:     map[LandmarkType]int{LandmarkCover: 0, LandmarkStart: 2},
+			},
+		},
+		Cover: &Cover{Path: "cover.jpg", Resource: ResourceName(1), Format: "jpg", Width: 600, Height: 800},
+	})
+	require.Equal(t, map[string]string{
+		"cover_page": pdf.Locations[0].Key,
+		"srl":        pdf.Locations[3].Key,
+		"bodymatter": pdf.Locations[3].Key,
+	}, marks)
+
+	// landmarks on pages left out of the book are dropped
+	pdf, marks = landmarks(PDFInfo{
+		Title: "title",
+		Autor: "author",
+		Sources: []Source{
+			{
+				Path:          "a.pdf",
+				Resource:      ResourceName(0),
+				NumberOfPages: 4,
+				Pages:         []int{1, 2, 3},
+				Landmarks:     map[LandmarkType]int{LandmarkCover: 0, LandmarkStart: 1, LandmarkBody: 3},
+			},
+		},
+	})
+	require.Equal(t, map[string]string{
+		"srl":        pdf.Locations[0].Key,
+		"bodymatter": pdf.Locations[2].Key,
+	}, marks)
+}
+
+func TestBuildMaxId(t *testing.T) {
+	_, store := buildInMemory(t, PDFInfo{
+		Title: "title",
+		Autor: "author",
+		Sources: []Source{
+			{Path: "a.pdf", Resource: ResourceName(0), NumberOfPages: 150},
+			{Path: "b.pdf", Resource: ResourceName(1), NumberOfPages: 20},
+		},
+	})
+	require.NoError(t, Validate(store))
+
+	catalog := map[string]bool{}
+	for _, symbol := range wion.Items_symbols_string {
+		catalog[symbol] = true
+	}
+
+	maxIds := map[string]int64{}
+	ids := 0
+	require.NoError(t, store.Fragments(func(f db.Fragment) error {
+		if !catalog[f.Id] {
+			ids++
+		}
+		values, err := ionreader.Decode(f.PayloadValue)
+		if f.PayloadType != "blob" || err != nil {
+			return nil
+		}
+		for _, v := range values {
+			if v.HasAnnotation("document_data") {
+				maxIds["document_data"] = v.Field("max_id").GetInt()
+			}
+			if f.Id == "max_id" {
+				maxIds["max_id"] = v.GetInt()
+			}
+		}
+		return nil
+	}))
+
+	require.Len(t, maxIds, 2)
+	require.Equal(t, maxIds["document_data"], maxIds["max_id"])
+	// every fragment id outside of the catalog is counted
+	require.GreaterOrEqual(t, maxIds["max_id"], int64(len(wion.Items_symbols_string)+ids))
+}
+
+func TestCreateNewPDFRollback(t *testing.T) {
+	source := Source{Resource: ResourceName(0), NumberOfPages: 1, PageSizes: []PageSize{DefaultPageSize}}
+	pdfInfo := PDFInfo{Sources: []Source{source, source}}
+
+	// the second pdf has the resource of the first one, the half built book
+	// is not committed
+	dir := t.TempDir()
+	require.Error(t, CreateNewPDF(pdfInfo, dir))
+
+	d, err := db.OpenDB(path.Join(dir, "temp.db"))
+	require.NoError(t, err)
+	defer d.Close()
+	fragments := 0
+	require.NoError(t, d.Fragments(func(db.Fragment) error {
+		fragments++
+		return nil
+	}))
+	require.Zero(t, fragments)
+}
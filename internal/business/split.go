@@ -0,0 +1,122 @@
+package business
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Split cuts each page into a grid of views, each one shown as its own
+// section pointing at the same page with its own crop
+type Split struct {
+	Rows    int
+	Columns int
+	// Overlap is the part of its neighbours shown by each view, in percent of
+	// the view size, from 0 to less than 100
+	Overlap float64
+	// RTL reads the columns from right to left
+	RTL bool
+}
+
+// ParseSplit parses a view split: halves (top and bottom), columns (left
+// and right) or a grid of rows and columns such as 3x2. An empty split keeps
+// the pages whole.
+func ParseSplit(spec string) (Split, error) {
+	switch spec = strings.TrimSpace(spec); spec {
+	case "":
+		return Split{Rows: 1, Columns: 1}, nil
+	case "halves":
+		return Split{Rows: 2, Columns: 1}, nil
+	case "columns":
+		return Split{Rows: 1, Columns: 2}, nil
+	}
+
+	rows, columns, ok := strings.Cut(spec, "x")
+	r, errRows := strconv.Atoi(rows)
+	c, errColumns := strconv.Atoi(columns)
+	if !ok || errRows != nil || errColumns != nil || r < 1 || c < 1 {
+		return Split{}, fmt.Errorf("invalid split %q, expected halves, columns or RxC", spec)
+	}
+	return Split{Rows: r, Columns: c}, nil
+}
+
+// columnPadding is kept around the regions of the columns, in points
+const columnPadding = 4
+
+// Views returns the views of a page: one per region when its columns are
+// known, else the views of the split. The regions are cut from the cropped
+// page, the two columns being read from right to left when RTL.
+func (source Source) Views(page Page) []Page {
+	if page.Index >= len(source.Columns) || len(source.Columns[page.Index]) == 0 {
+		return source.Split.Views(page)
+	}
+
+	regions := append([]Bounds{}, source.Columns[page.Index]...)
+	if source.Split.RTL {
+		// the header and the footer span the page, the columns are the
+		// regions side by side
+		for i := 0; i+1 < len(regions); i++ {
+			if regions[i].Right <= regions[i+1].Left {
+				regions[i], regions[i+1] = regions[i+1], regions[i]
+				i++
+			}
+		}
+	}
+
+	views := []Page{}
+	for _, region := range regions {
+		view := page
+		view.Left = math.Max(page.Left, region.Left-columnPadding)
+		view.Right = math.Max(page.Right, page.Size.Width-region.Right-columnPadding)
+		view.Top = math.Max(page.Top, page.Size.Height-region.Top-columnPadding)
+		view.Bottom = math.Max(page.Bottom, region.Bottom-columnPadding)
+		if view.Width() < 1 || view.Height() < 1 {
+			// the region is cropped away
+			continue
+		}
+		views = append(views, view)
+	}
+	if len(views) == 0 {
+		return []Page{page}
+	}
+	return views
+}
+
+// Views returns the views of a page in reading order: rows from top to
+// bottom, then columns from left to right, or right to left when RTL
+func (s Split) Views(page Page) []Page {
+	rows := max(s.Rows, 1)
+	columns := max(s.Columns, 1)
+	if rows == 1 && columns == 1 {
+		return []Page{page}
+	}
+
+	width := page.Width() / float64(columns)
+	height := page.Height() / float64(rows)
+	overlapX := width * s.Overlap / 100
+	overlapY := height * s.Overlap / 100
+
+	views := []Page{}
+	for row := 0; row < rows; row++ {
+		for i := 0; i < columns; i++ {
+			column := i
+			if s.RTL {
+				column = columns - 1 - i
+			}
+
+			left := math.Max(0, float64(column)*width-overlapX)
+			right := math.Min(page.Width(), float64(column+1)*width+overlapX)
+			top := math.Max(0, float64(row)*height-overlapY)
+			bottom := math.Min(page.Height(), float64(row+1)*height+overlapY)
+
+			view := page
+			view.Left = page.Left + left
+			view.Right = page.Right + page.Width() - right
+			view.Top = page.Top + top
+			view.Bottom = page.Bottom + page.Height() - bottom
+			views = append(views, view)
+		}
+	}
+	return views
+}
@@ -0,0 +1,111 @@
+package business
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSplit(t *testing.T) {
+	for spec, expected := range map[string]Split{
+		"":        {Rows: 1, Columns: 1},
+		"halves":  {Rows: 2, Columns: 1},
+		"columns": {Rows: 1, Columns: 2},
+		"3x2":     {Rows: 3, Columns: 2},
+	} {
+		split, err := ParseSplit(spec)
+		require.NoError(t, err, spec)
+		require.Equal(t, expected, split, spec)
+	}
+
+	for _, spec := range []string{"3", "0x2", "ax2", "thirds"} {
+		_, err := ParseSplit(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestViews(t *testing.T) {
+	page := Page{Index: 4, Size: PageSize{Width: 600, Height: 800}, Top: 50, Right: 50, Bottom: 50, Left: 50}
+	margins := func(views []Page) [][4]float64 {
+		m := [][4]float64{}
+		for _, v := range views {
+			require.Equal(t, page.Index, v.Index)
+			m = append(m, [4]float64{v.Top, v.Right, v.Bottom, v.Left})
+		}
+		return m
+	}
+
+	require.Equal(t, []Page{page}, Split{}.Views(page))
+
+	require.Equal(t, [][4]float64{
+		{50, 50, 400, 50},
+		{400, 50, 50, 50},
+	}, margins(Split{Rows: 2, Columns: 1}.Views(page)))
+
+	require.Equal(t, [][4]float64{
+		{50, 300, 50, 50},
+		{50, 50, 50, 300},
+	}, margins(Split{Rows: 1, Columns: 2}.Views(page)))
+
+	require.Equal(t, [][4]float64{
+		{50, 50, 50, 300},
+		{50, 300, 50, 50},
+	}, margins(Split{Rows: 1, Columns: 2, RTL: true}.Views(page)))
+
+	// each view shows 10% of its neighbours
+	require.Equal(t, [][4]float64{
+		{50, 275, 365, 50},
+		{50, 50, 365, 275},
+		{365, 275, 50, 50},
+		{365, 50, 50, 275},
+	}, margins(Split{Rows: 2, Columns: 2, Overlap: 10}.Views(page)))
+}
+
+func TestColumnViews(t *testing.T) {
+	source := Source{
+		Columns: [][]Bounds{
+			nil,
+			{{50, 700, 550, 750}, {50, 100, 290, 690}, {310, 100, 550, 690}},
+		},
+		Split: Split{Rows: 2, Columns: 1},
+	}
+	size := PageSize{Width: 600, Height: 800}
+
+	// pages without columns are split
+	require.Len(t, source.Views(Page{Index: 0, Size: size}), 2)
+
+	margins := [][4]float64{}
+	for _, v := range source.Views(Page{Index: 1, Size: size, Top: 20}) {
+		margins = append(margins, [4]float64{v.Top, v.Right, v.Bottom, v.Left})
+	}
+	require.Equal(t, [][4]float64{
+		{46, 46, 696, 46},
+		{106, 306, 96, 46},
+		{106, 46, 96, 306},
+	}, margins)
+
+	// the regions keep the crop of the page, the footer being cropped away
+	source.Columns[1] = append(source.Columns[1], Bounds{50, 20, 550, 60})
+	margins = [][4]float64{}
+	for _, v := range source.Views(Page{Index: 1, Size: size, Left: 100, Bottom: 80}) {
+		margins = append(margins, [4]float64{v.Top, v.Right, v.Bottom, v.Left})
+	}
+	require.Equal(t, [][4]float64{
+		{46, 46, 696, 100},
+		{106, 306, 96, 100},
+		{106, 46, 96, 306},
+	}, margins)
+
+	// the columns, not the header, are read from right to left
+	source.Split.RTL = true
+	margins = [][4]float64{}
+	for _, v := range source.Views(Page{Index: 1, Size: size}) {
+		margins = append(margins, [4]float64{v.Top, v.Right, v.Bottom, v.Left})
+	}
+	require.Equal(t, [][4]float64{
+		{46, 46, 696, 46},
+		{106, 46, 96, 306},
+		{106, 306, 96, 46},
+		{736, 46, 16, 46},
+	}, margins)
+}
@@ -0,0 +1,310 @@
+package business
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"pdf_raw_printing/internal/libs/db"
+	"pdf_raw_printing/internal/libs/ionreader"
+	"pdf_raw_printing/internal/libs/kdf"
+	"sort"
+)
+
+// book is the decoded content of a book, as read by the validator
+type book struct {
+	fragments    map[string]*ionreader.Value
+	ids          []string
+	elementTypes map[string]string
+}
+
+func loadBook(fragments db.FragmentIterator) (*book, error) {
+	b := book{
+		fragments:    map[string]*ionreader.Value{},
+		ids:          []string{},
+		elementTypes: map[string]string{},
+	}
+
+	err := fragments.Fragments(func(f db.Fragment) error {
+		b.ids = append(b.ids, f.Id)
+		if f.PayloadType != "blob" {
+			return nil
+		}
+
+		values, err := ionreader.Decode(f.PayloadValue)
+		if err != nil {
+			return fmt.Errorf("fragment %s: %w", f.Id, err)
+		}
+		if len(values) == 1 {
+			b.fragments[f.Id] = values[0]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = fragments.FragmentProperties(func(p db.FragmentProperty) error {
+		if p.Key == "element_type" {
+			b.elementTypes[p.Id] = p.Value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(b.ids)
+	return &b, nil
+}
+
+// idsOfType returns the sorted ids of the fragments of an element type
+func (b *book) idsOfType(elementType string) []string {
+	ids := []string{}
+	for _, id := range b.ids {
+		if b.elementTypes[id] == elementType {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// readingOrderSections returns the sections listed in the reading orders of
+// a document_data or metadata fragment
+func readingOrderSections(v *ionreader.Value) map[string]bool {
+	sections := map[string]bool{}
+	for _, readingOrder := range v.Field("reading_orders").GetChildren() {
+		for _, section := range readingOrder.Field("sections").GetChildren() {
+			sections[section.Text] = true
+		}
+	}
+	return sections
+}
+
+// Validate checks the integrity of a book:
+//   - every fragment has an element_type
+//   - every kfx_id reference resolves to a fragment or a kfx_id defined in one
+//   - every section appears in the document_data and metadata reading orders
+//   - eid buckets cover every eid
+//   - section pid counts match the section_position_id_map entries
+//
+// Every problem found is reported in the returned error.
+func Validate(fragments db.FragmentIterator) error {
+	b, err := loadBook(fragments)
+	if err != nil {
+		return err
+	}
+
+	problems := []error{}
+	problems = append(problems, b.checkElementTypes()...)
+	problems = append(problems, b.checkReferences()...)
+	problems = append(problems, b.checkReadingOrders()...)
+	problems = append(problems, b.checkEidBuckets()...)
+	problems = append(problems, b.checkPidCounts()...)
+
+	return errors.Join(problems...)
+}
+
+func (b *book) checkElementTypes() []error {
+	problems := []error{}
+	for _, id := range b.ids {
+		if b.elementTypes[id] == "" {
+			problems = append(problems, fmt.Errorf("fragment %s has no element_type", id))
+		}
+	}
+	return problems
+}
+
+// definingFields are the fields whose kfx_id value names the element holding
+// it rather than referencing another one
+var definingFields = map[string]bool{
+	"kfx_id":             true,
+	"nav_container_name": true,
+	"nav_unit_name":      true,
+	"anchor_name":        true,
+}
+
+func (b *book) checkReferences() []error {
+	defined := map[string]bool{}
+	for _, id := range b.ids {
+		defined[id] = true
+		if v, exists := b.fragments[id]; exists {
+			v.Walk(func(v *ionreader.Value) {
+				if definingFields[v.Name] && v.HasAnnotation("kfx_id") {
+					defined[v.Text] = true
+				}
+			})
+		}
+	}
+
+	problems := []error{}
+	for _, id := range b.ids {
+		v, exists := b.fragments[id]
+		if !exists {
+			continue
+		}
+		v.Walk(func(v *ionreader.Value) {
+			if definingFields[v.Name] || !v.HasAnnotation("kfx_id") {
+				return
+			}
+			if !defined[v.Text] {
+				problems = append(problems, fmt.Errorf("fragment %s references missing kfx_id %s", id, v.Text))
+			}
+		})
+	}
+	return problems
+}
+
+func (b *book) checkReadingOrders() []error {
+	problems := []error{}
+	for _, name := range []string{"document_data", "metadata"} {
+		v, exists := b.fragments[name]
+		if !exists {
+			problems = append(problems, fmt.Errorf("missing %s fragment", name))
+			continue
+		}
+
+		sections := readingOrderSections(v)
+		for _, section := range b.idsOfType("section") {
+			if !sections[section] {
+				problems = append(problems, fmt.Errorf("section %s is missing from %s reading orders", section, name))
+			}
+		}
+	}
+	return problems
+}
+
+// sectionEids returns the eids of each section: the section itself and every
+// element of its section_position_id_map
+func (b *book) sectionEids() map[string][]string {
+	eids := map[string][]string{}
+	for _, id := range b.idsOfType("section_position_id_map") {
+		v := b.fragments[id]
+		section := v.Field("section_name").GetText()
+		eids[section] = append(eids[section], section)
+		for _, entry := range v.Field("contains").GetChildren() {
+			if len(entry.Children) == 2 {
+				eids[section] = append(eids[section], entry.Children[1].Text)
+			}
+		}
+	}
+	return eids
+}
+
+func (b *book) checkEidBuckets() []error {
+	buckets := map[int64]map[string]string{}
+	for _, id := range b.idsOfType("yj.eidhash_eid_section_map") {
+		v := b.fragments[id]
+		block := v.Field("block").GetInt()
+		if buckets[block] == nil {
+			buckets[block] = map[string]string{}
+		}
+		for _, el := range v.Field("contains").GetChildren() {
+			buckets[block][el.Field("eid").GetText()] = el.Field("section_name").GetText()
+		}
+	}
+
+	problems := []error{}
+	eids := b.sectionEids()
+	for _, section := range sortedKeys(eids) {
+		for _, eid := range eids[section] {
+			block := int64(ComputeEID(eid))
+			inSection, exists := buckets[block][eid]
+			if !exists {
+				problems = append(problems, fmt.Errorf("eid %s is missing from eidbucket_%d", eid, block))
+			} else if inSection != section {
+				problems = append(problems, fmt.Errorf("eid %s is mapped to section %s instead of %s", eid, inSection, section))
+			}
+		}
+	}
+	return problems
+}
+
+func (b *book) checkPidCounts() []error {
+	v, exists := b.fragments["yj.section_pid_count_map"]
+	if !exists {
+		return []error{fmt.Errorf("missing yj.section_pid_count_map fragment")}
+	}
+
+	counts := map[string]int64{}
+	for _, el := range v.Field("contains").GetChildren() {
+		counts[el.Field("section_name").GetText()] = el.Field("length").GetInt()
+	}
+
+	problems := []error{}
+	for _, id := range b.idsOfType("section_position_id_map") {
+		spm := b.fragments[id]
+		section := spm.Field("section_name").GetText()
+		length := int64(len(spm.Field("contains").GetChildren()))
+		count, exists := counts[section]
+		if !exists {
+			problems = append(problems, fmt.Errorf("section %s has no pid count", section))
+		} else if count != length {
+			problems = append(problems, fmt.Errorf("section %s pid count is %d but %s has %d entries", section, count, id, length))
+		}
+	}
+	return problems
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ValidateKDF validates a book.kdf file
+func ValidateKDF(kdfpath string) error {
+	f, err := os.Open(kdfpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return validateKDFReader(f)
+}
+
+// ValidateKPF validates the book.kdf of a KPF package
+func ValidateKPF(kpfpath string) error {
+	archive, err := zip.OpenReader(kpfpath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	f, err := archive.Open("resources/book.kdf")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return validateKDFReader(f)
+}
+
+func validateKDFReader(r io.Reader) error {
+	// SQLite needs a file, the unwrapped database is written to a temporary one
+	tmp, err := os.CreateTemp("", "book-*.db")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = kdf.Unwrap(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	myDB, err := db.OpenDB(tmp.Name())
+	if err != nil {
+		return err
+	}
+	defer myDB.Close()
+
+	return Validate(myDB)
+}
@@ -2,9 +2,10 @@ package db
 
 import (
 	"database/sql"
-	"fmt"
 	"os"
 	"pdf_raw_printing/internal/libs/wion"
+	"strconv"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -16,93 +17,23 @@ type DB struct {
 
 var TESTED = "$ion_symbol_table"
 
-var defaultGCFragment = []string{
+// rootElementTypes are the element types of the fragments a reader looks up
+// directly. Every other fragment is only kept if it can be reached from one of
+// them through the child edges of fragment_properties.
+var rootElementTypes = []string{
 	"$ion_symbol_table",
 	"book_metadata",
 	"book_navigation",
-	// "c0",
-	// "c0-ad",
-	// "c0-spm",
 	"content_features",
-	// "d6",
-	// "d7",
 	"document_data",
-	// "e9",
-	"eidbucket_0",
-	"eidbucket_1",
-	"eidbucket_10",
-	"eidbucket_11",
-	"eidbucket_12",
-	"eidbucket_13",
-	"eidbucket_14",
-	"eidbucket_15",
-	"eidbucket_16",
-	"eidbucket_17",
-	"eidbucket_18",
-	"eidbucket_19",
-	"eidbucket_2",
-	"eidbucket_20",
-	"eidbucket_21",
-	"eidbucket_22",
-	"eidbucket_23",
-	"eidbucket_24",
-	"eidbucket_25",
-	"eidbucket_26",
-	"eidbucket_27",
-	"eidbucket_28",
-	"eidbucket_29",
-	"eidbucket_3",
-	"eidbucket_30",
-	"eidbucket_31",
-	"eidbucket_32",
-	"eidbucket_33",
-	"eidbucket_34",
-	"eidbucket_35",
-	"eidbucket_36",
-	"eidbucket_37",
-	"eidbucket_38",
-	"eidbucket_39",
-	"eidbucket_4",
-	"eidbucket_40",
-	"eidbucket_41",
-	"eidbucket_42",
-	"eidbucket_43",
-	"eidbucket_44",
-	"eidbucket_45",
-	"eidbucket_46",
-	"eidbucket_47",
-	"eidbucket_48",
-	"eidbucket_49",
-	"eidbucket_5",
-	"eidbucket_50",
-	"eidbucket_51",
-	"eidbucket_52",
-	"eidbucket_53",
-	"eidbucket_54",
-	"eidbucket_55",
-	"eidbucket_56",
-	"eidbucket_57",
-	"eidbucket_58",
-	"eidbucket_59",
-	"eidbucket_6",
-	"eidbucket_60",
-	"eidbucket_61",
-	"eidbucket_62",
-	"eidbucket_63",
-	"eidbucket_64",
-	"eidbucket_65",
-	"eidbucket_66",
-	"eidbucket_7",
-	"eidbucket_8",
-	"eidbucket_9",
-	// "i4",
-	// "i5",
-	// "l2",
 	"location_map",
 	"max_id",
 	"metadata",
 	"root_entity",
-	"rsrc8",
+	"section",
+	"section_position_id_map",
+	"bcRawMedia",
+	"yj.eidhash_eid_section_map",
 	"yj.kfxid_eid_map",
 	"yj.section_pid_count_map",
 }
@@ -139,13 +70,6 @@ func CreateNewDB(filepath string) (*DB, error) {
 		return nil, err
 	}
 
-	for _, el := range defaultGCFragment {
-		_, err = db.Exec(`INSERT INTO gc_reachable (id) VALUES ($1);`, el)
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	_, err = db.Exec(`CREATE TABLE fragment_properties(id char(40), key char(40), value char(40), primary key (id, key, value)) without rowid;`)
 	if err != nil {
 		return nil, err
@@ -162,6 +86,35 @@ func CreateNewDB(filepath string) (*DB, error) {
 	}, nil
 }
 
+// OpenDB opens an existing book database, for reading it back
+func OpenDB(filepath string) (*DB, error) {
+	if _, err := os.Stat(filepath); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DB{
+		db:   db,
+		Path: filepath,
+	}, nil
+}
+
+func (db *DB) Close() error {
+	return db.db.Close()
+}
+
+func (db *DB) Fragments(fn func(Fragment) error) error {
+	return queryFragments(db.db, fn)
+}
+
+func (db *DB) FragmentProperties(fn func(FragmentProperty) error) error {
+	return queryFragmentProperties(db.db, fn)
+}
+
 func (db *DB) InsertFragment(id string, payloadtype string, payloadvalue []byte) error {
 	_, err := db.db.Exec("INSERT INTO fragments (id, payload_type, payload_value) VALUES ($1, $2, $3)", id, payloadtype, payloadvalue)
 	return err
@@ -181,7 +134,140 @@ func (db *DB) InsertGCReachable(id string) error {
 	return err
 }
 
+// Finalize fills gc_reachable and gc_fragment_properties from the fragment
+// graph: the fragments of a root element type, and everything reachable from
+// them through child edges. It replaces any previous content of both tables,
+// so it can be called again after the book is modified.
+func (db *DB) Finalize() error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec("DELETE FROM gc_reachable")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM gc_fragment_properties")
+	if err != nil {
+		return err
+	}
+
+	placeholders := make([]string, len(rootElementTypes))
+	args := make([]any, len(rootElementTypes))
+	for i, el := range rootElementTypes {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		args[i] = el
+	}
+
+	_, err = tx.Exec(`WITH RECURSIVE reachable(id) AS (
+		SELECT id FROM fragment_properties WHERE key = 'element_type' AND value IN (`+strings.Join(placeholders, ", ")+`)
+		UNION
+		SELECT fp.value FROM fragment_properties fp JOIN reachable r ON fp.id = r.id WHERE fp.key = 'child'
+	)
+	INSERT INTO gc_reachable (id) SELECT id FROM reachable WHERE id IN (SELECT id FROM fragments)`, args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO gc_fragment_properties (id, key, value)
+		SELECT id, key, value FROM fragment_properties WHERE id IN (SELECT id FROM gc_reachable)`)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (db *DB) InsertFragmentProperties(id string, key, value string) error {
-	_, err := db.db.Exec(fmt.Sprintf("INSERT INTO fragment_properties (id, key, value) VALUES ('%s', '%s', '%s')", id, key, value))
+	_, err := db.db.Exec("INSERT INTO fragment_properties (id, key, value) VALUES ($1, $2, $3)", id, key, value)
+	return err
+}
+
+// InsertOrIgnoreFragmentProperties behaves like InsertFragmentProperties but
+// silently skips a (id, key, value) triple that is already stored, so a
+// fragment can be rebuilt without failing on its existing properties.
+func (db *DB) InsertOrIgnoreFragmentProperties(id string, key, value string) error {
+	_, err := db.db.Exec("INSERT OR IGNORE INTO fragment_properties (id, key, value) VALUES ($1, $2, $3)", id, key, value)
+	return err
+}
+
+// Batch groups fragment writes inside a single transaction, reusing the same
+// prepared statements for every row. Building a large book through a Batch
+// avoids one SQLite transaction per fragment and property.
+type Batch struct {
+	tx               *sql.Tx
+	fragments        *sql.Stmt
+	properties       *sql.Stmt
+	ignoreProperties *sql.Stmt
+}
+
+func (db *DB) Begin() (*Batch, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &Batch{tx: tx}
+
+	batch.fragments, err = tx.Prepare("INSERT INTO fragments (id, payload_type, payload_value) VALUES ($1, $2, $3)")
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	batch.properties, err = tx.Prepare("INSERT INTO fragment_properties (id, key, value) VALUES ($1, $2, $3)")
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	batch.ignoreProperties, err = tx.Prepare("INSERT OR IGNORE INTO fragment_properties (id, key, value) VALUES ($1, $2, $3)")
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+func (b *Batch) InsertFragment(id string, payloadtype string, payloadvalue []byte) error {
+	_, err := b.fragments.Exec(id, payloadtype, payloadvalue)
+	return err
+}
+
+func (b *Batch) InsertHashFragments(id string, payloadType string, v any) error {
+	hash24, err := wion.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return b.InsertFragment(id, payloadType, hash24)
+}
+
+func (b *Batch) InsertFragmentProperties(id string, key, value string) error {
+	_, err := b.properties.Exec(id, key, value)
+	return err
+}
+
+func (b *Batch) InsertOrIgnoreFragmentProperties(id string, key, value string) error {
+	_, err := b.ignoreProperties.Exec(id, key, value)
+	return err
+}
+
+// Commit writes every row of the batch. The statements are closed along with
+// the transaction, so the batch must not be reused afterwards.
+func (b *Batch) Commit() error {
+	return b.tx.Commit()
+}
+
+// Rollback discards the batch. It is a no-op once the batch is committed.
+func (b *Batch) Rollback() error {
+	err := b.tx.Rollback()
+	if err == sql.ErrTxDone {
+		return nil
+	}
 	return err
 }
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDB(t *testing.T) *DB {
+	myDB, err := CreateNewDB(path.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	return myDB
+}
+
+func TestInsertFragmentPropertiesHostileValues(t *testing.T) {
+	myDB := newTestDB(t)
+
+	hostile := []string{
+		"c'0",
+		"'); DROP TABLE fragments; --",
+		`e"9`,
+		"l2\\'",
+		"",
+	}
+
+	for _, id := range hostile {
+		require.NoError(t, myDB.InsertFragmentProperties(id, "element_type", id))
+		require.NoError(t, myDB.InsertFragment(id, "blob", []byte(id)))
+	}
+
+	for _, id := range hostile {
+		var value string
+		err := myDB.db.QueryRow("SELECT value FROM fragment_properties WHERE id = $1 AND key = $2", id, "element_type").Scan(&value)
+		require.NoError(t, err)
+		require.Equal(t, id, value)
+	}
+
+	var count int
+	require.NoError(t, myDB.db.QueryRow("SELECT count(*) FROM fragments").Scan(&count))
+	require.Equal(t, len(hostile), count)
+}
+
+func TestInsertFragmentPropertiesDuplicate(t *testing.T) {
+	myDB := newTestDB(t)
+
+	require.NoError(t, myDB.InsertFragmentProperties("c0", "child", "l2"))
+	require.Error(t, myDB.InsertFragmentProperties("c0", "child", "l2"))
+
+	require.NoError(t, myDB.InsertOrIgnoreFragmentProperties("c0", "child", "l2"))
+	require.NoError(t, myDB.InsertOrIgnoreFragmentProperties("c0", "child", "i'4"))
+	require.NoError(t, myDB.InsertOrIgnoreFragmentProperties("c0", "child", "i'4"))
+
+	var count int
+	require.NoError(t, myDB.db.QueryRow("SELECT count(*) FROM fragment_properties WHERE id = $1", "c0").Scan(&count))
+	require.Equal(t, 2, count)
+}
+
+// inserter is satisfied by both DB and Batch, so the benchmark can replay the
+// same synthetic book through either path.
+type inserter interface {
+	InsertFragment(id string, payloadtype string, payloadvalue []byte) error
+	InsertFragmentProperties(id string, key, value string) error
+}
+
+const benchmarkPages = 2000
+
+// writeSyntheticPages mimics the fragments and properties written by
+// business.AddPage for each page of a book.
+func writeSyntheticPages(b *testing.B, w inserter, pages int) {
+	payload := make([]byte, 64)
+	for i := 0; i < pages; i++ {
+		p := strconv.Itoa(i)
+		c, l, e, i4, i5 := "c"+p, "l"+p, "e"+p, "i4-"+p, "i5-"+p
+
+		properties := [][3]string{
+			{c, "child", c + "-ad"},
+			{c, "child", l},
+			{c, "element_type", "section"},
+			{c + "-ad", "element_type", "auxiliary_data"},
+			{c + "-spm", "element_type", "section_position_id_map"},
+			{e, "child", "d6"},
+			{e, "child", "rsrc8"},
+			{e, "element_type", "external_resource"},
+			{i5, "child", e},
+			{i5, "element_type", "structure"},
+			{i4, "child", i5},
+			{i4, "element_type", "structure"},
+			{l, "child", l},
+			{l, "child", i4},
+			{l, "element_type", "storyline"},
+		}
+		for _, prop := range properties {
+			if err := w.InsertFragmentProperties(prop[0], prop[1], prop[2]); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		for _, id := range []string{c, c + "-ad", c + "-spm", e, i5, i4, l} {
+			if err := w.InsertFragment(id, "blob", payload); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkBuild2000Pages(b *testing.B) {
+	b.Run("autocommit", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			b.StopTimer()
+			myDB, err := CreateNewDB(path.Join(b.TempDir(), "bench.db"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.StartTimer()
+
+			writeSyntheticPages(b, myDB, benchmarkPages)
+		}
+	})
+
+	b.Run("batch", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			b.StopTimer()
+			myDB, err := CreateNewDB(path.Join(b.TempDir(), "bench.db"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.StartTimer()
+
+			batch, err := myDB.Begin()
+			if err != nil {
+				b.Fatal(err)
+			}
+			writeSyntheticPages(b, batch, benchmarkPages)
+			if err := batch.Commit(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func queryIds(t *testing.T, myDB *DB, query string) []string {
+	rows, err := myDB.db.Query(query)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		require.NoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	require.NoError(t, rows.Err())
+	return ids
+}
+
+func TestFinalize(t *testing.T) {
+	myDB := newTestDB(t)
+
+	fragments := map[string][][2]string{
+		"document_data": {{"element_type", "document_data"}, {"child", "d7"}},
+		"d7":            {{"element_type", "auxiliary_data"}},
+		"c0":            {{"element_type", "section"}, {"child", "l2"}, {"child", "missing"}},
+		"l2":            {{"element_type", "storyline"}, {"child", "l2"}, {"child", "e9"}},
+		"e9":            {{"element_type", "external_resource"}, {"child", "rsrc8"}},
+		"rsrc8":         {{"element_type", "bcRawMedia"}},
+		"orphan":        {{"element_type", "structure"}, {"child", "e9"}},
+	}
+	for id, properties := range fragments {
+		require.NoError(t, myDB.InsertFragment(id, "blob", []byte{}))
+		for _, prop := range properties {
+			require.NoError(t, myDB.InsertFragmentProperties(id, prop[0], prop[1]))
+		}
+	}
+
+	// run twice to check the tables are rebuilt rather than appended to
+	require.NoError(t, myDB.Finalize())
+	require.NoError(t, myDB.Finalize())
+
+	require.Equal(t,
+		[]string{"c0", "d7", "document_data", "e9", "l2", "rsrc8"},
+		queryIds(t, myDB, "SELECT id FROM gc_reachable ORDER BY id"))
+
+	require.Equal(t,
+		[]string{"c0", "c0", "c0", "d7", "document_data", "document_data", "e9", "e9", "l2", "l2", "l2", "rsrc8"},
+		queryIds(t, myDB, "SELECT id FROM gc_fragment_properties ORDER BY id"))
+}
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"pdf_raw_printing/internal/libs/wion"
+)
+
+type Fragment struct {
+	Id           string
+	PayloadType  string
+	PayloadValue []byte
+}
+
+type FragmentProperty struct {
+	Id    string
+	Key   string
+	Value string
+}
+
+// FragmentIterator reads back the fragments of a book and their properties.
+// Iteration follows insertion order for the in-memory store and primary key
+// order for SQLite.
+type FragmentIterator interface {
+	Fragments(fn func(Fragment) error) error
+	FragmentProperties(fn func(FragmentProperty) error) error
+}
+
+// FragmentStore holds the fragments of a book and their properties
+type FragmentStore interface {
+	FragmentIterator
+	InsertFragment(id string, payloadtype string, payloadvalue []byte) error
+	InsertFragmentProperties(id string, key, value string) error
+	// Close keeps the book, Rollback discards a book left half built. Either
+	// one ends the store.
+	Close() error
+	Rollback() error
+}
+
+func InsertHashFragments(store FragmentStore, id string, payloadType string, v any) error {
+	hash24, err := wion.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return store.InsertFragment(id, payloadType, hash24)
+}
+
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func queryFragments(q queryer, fn func(Fragment) error) error {
+	rows, err := q.Query("SELECT id, payload_type, payload_value FROM fragments ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		f := Fragment{}
+		if err := rows.Scan(&f.Id, &f.PayloadType, &f.PayloadValue); err != nil {
+			return err
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func queryFragmentProperties(q queryer, fn func(FragmentProperty) error) error {
+	rows, err := q.Query("SELECT id, key, value FROM fragment_properties ORDER BY id, key, value")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := FragmentProperty{}
+		if err := rows.Scan(&p.Id, &p.Key, &p.Value); err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// SQLiteStore writes the book into a SQLite database. Every write goes through
+// a single batch, committed along with the gc tables on Close.
+type SQLiteStore struct {
+	db    *DB
+	batch *Batch
+}
+
+func NewSQLiteStore(filepath string) (*SQLiteStore, error) {
+	myDB, err := CreateNewDB(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := myDB.Begin()
+	if err != nil {
+		_ = myDB.Close()
+		return nil, err
+	}
+
+	return &SQLiteStore{
+		db:    myDB,
+		batch: batch,
+	}, nil
+}
+
+func (s *SQLiteStore) InsertFragment(id string, payloadtype string, payloadvalue []byte) error {
+	return s.batch.InsertFragment(id, payloadtype, payloadvalue)
+}
+
+func (s *SQLiteStore) InsertFragmentProperties(id string, key, value string) error {
+	return s.batch.InsertFragmentProperties(id, key, value)
+}
+
+func (s *SQLiteStore) Fragments(fn func(Fragment) error) error {
+	return queryFragments(s.batch.tx, fn)
+}
+
+func (s *SQLiteStore) FragmentProperties(fn func(FragmentProperty) error) error {
+	return queryFragmentProperties(s.batch.tx, fn)
+}
+
+// Close commits the book, fills the gc tables and closes the database
+func (s *SQLiteStore) Close() error {
+	err := s.batch.Commit()
+	if err == nil {
+		err = s.db.Finalize()
+	}
+	if cerr := s.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Rollback discards the book, leaving the database without fragments, and
+// closes it
+func (s *SQLiteStore) Rollback() error {
+	err := s.batch.Rollback()
+	if cerr := s.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// MemoryStore keeps the book in memory, enforcing the same uniqueness rules
+// as the SQLite schema
+type MemoryStore struct {
+	fragments      []Fragment
+	properties     []FragmentProperty
+	fragmentIds    map[string]bool
+	propertyValues map[FragmentProperty]bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		fragments:      []Fragment{},
+		properties:     []FragmentProperty{},
+		fragmentIds:    map[string]bool{},
+		propertyValues: map[FragmentProperty]bool{},
+	}
+}
+
+func (s *MemoryStore) InsertFragment(id string, payloadtype string, payloadvalue []byte) error {
+	if s.fragmentIds[id] {
+		return fmt.Errorf("fragment %q already exists", id)
+	}
+	s.fragmentIds[id] = true
+	s.fragments = append(s.fragments, Fragment{
+		Id:           id,
+		PayloadType:  payloadtype,
+		PayloadValue: append([]byte{}, payloadvalue...),
+	})
+	return nil
+}
+
+func (s *MemoryStore) InsertFragmentProperties(id string, key, value string) error {
+	p := FragmentProperty{Id: id, Key: key, Value: value}
+	if s.propertyValues[p] {
+		return fmt.Errorf("fragment property (%q, %q, %q) already exists", id, key, value)
+	}
+	s.propertyValues[p] = true
+	s.properties = append(s.properties, p)
+	return nil
+}
+
+func (s *MemoryStore) Fragments(fn func(Fragment) error) error {
+	for _, f := range s.fragments {
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) FragmentProperties(fn func(FragmentProperty) error) error {
+	for _, p := range s.properties {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) Rollback() error {
+	return nil
+}
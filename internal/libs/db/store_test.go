@@ -0,0 +1,82 @@
+package db
+
+import (
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func collect(t *testing.T, store FragmentStore) ([]string, []FragmentProperty) {
+	ids := []string{}
+	require.NoError(t, store.Fragments(func(f Fragment) error {
+		ids = append(ids, f.Id)
+		return nil
+	}))
+
+	properties := []FragmentProperty{}
+	require.NoError(t, store.FragmentProperties(func(p FragmentProperty) error {
+		properties = append(properties, p)
+		return nil
+	}))
+
+	return ids, properties
+}
+
+func TestStores(t *testing.T) {
+	sqliteStore, err := NewSQLiteStore(path.Join(t.TempDir(), "store.db"))
+	require.NoError(t, err)
+
+	stores := map[string]FragmentStore{
+		"memory": NewMemoryStore(),
+		"sqlite": sqliteStore,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, store.InsertFragment("c0", "blob", []byte{1}))
+			require.NoError(t, InsertHashFragments(store, "max_id", "blob", struct {
+				Value int `wion:"max_id"`
+			}{Value: 1}))
+			require.Error(t, store.InsertFragment("c0", "blob", []byte{2}))
+
+			require.NoError(t, store.InsertFragmentProperties("c0", "child", "l2"))
+			require.NoError(t, store.InsertFragmentProperties("c0", "element_type", "section"))
+			require.Error(t, store.InsertFragmentProperties("c0", "child", "l2"))
+
+			ids, properties := collect(t, store)
+			require.Equal(t, []string{"c0", "max_id"}, ids)
+			require.Equal(t, []FragmentProperty{
+				{Id: "c0", Key: "child", Value: "l2"},
+				{Id: "c0", Key: "element_type", Value: "section"},
+			}, properties)
+
+			require.NoError(t, store.Close())
+		})
+	}
+}
+
+func TestSQLiteStoreRollback(t *testing.T) {
+	dbPath := path.Join(t.TempDir(), "store.db")
+	store, err := NewSQLiteStore(dbPath)
+	require.NoError(t, err)
+	require.NoError(t, store.InsertFragment("c0", "blob", []byte{1}))
+	require.NoError(t, store.InsertFragmentProperties("c0", "element_type", "section"))
+	require.NoError(t, store.Rollback())
+
+	// neither the fragments nor the gc tables are written
+	d, err := OpenDB(dbPath)
+	require.NoError(t, err)
+	defer d.Close()
+	ids := []string{}
+	require.NoError(t, d.Fragments(func(f Fragment) error {
+		ids = append(ids, f.Id)
+		return nil
+	}))
+	require.Empty(t, ids)
+	reachable := 0
+	require.NoError(t, d.db.QueryRow("SELECT COUNT(*) FROM gc_reachable").Scan(&reachable))
+	require.Equal(t, 0, reachable)
+
+	require.NoError(t, NewMemoryStore().Rollback())
+}
@@ -41,11 +41,22 @@ var accessLetter = []string{
 	"Z",
 }
 
-var lastIndexPerSuffix = map[string]int{}
-var alreadyKnown = map[string]bool{}
+// Generator numbers ids by prefix, skipping the ids already known, so each
+// book numbers its ids from the start
+type Generator struct {
+	lastIndexPerSuffix map[string]int
+	alreadyKnown       map[string]bool
+}
+
+func New() *Generator {
+	return &Generator{
+		lastIndexPerSuffix: map[string]int{},
+		alreadyKnown:       map[string]bool{},
+	}
+}
 
-func Register(s string) {
-	alreadyKnown[s] = true
+func (g *Generator) Register(s string) {
+	g.alreadyKnown[s] = true
 }
 
 func gen(i int) string {
@@ -64,23 +75,23 @@ func gen(i int) string {
 	return s
 }
 
-func GetSize() int {
-	return len(alreadyKnown)
+func (g *Generator) GetSize() int {
+	return len(g.alreadyKnown)
 }
 
-func Generate(prefix string) string {
+func (g *Generator) Generate(prefix string) string {
 	var i int = 0
 	var ok bool
-	if i, ok = lastIndexPerSuffix[prefix]; !ok {
-		lastIndexPerSuffix[prefix] = i
+	if i, ok = g.lastIndexPerSuffix[prefix]; !ok {
+		g.lastIndexPerSuffix[prefix] = i
 	}
 
 	i++
-	lastIndexPerSuffix[prefix] = i
+	g.lastIndexPerSuffix[prefix] = i
 	s := prefix + gen(i)
-	if _, ok := alreadyKnown[s]; ok {
-		return Generate(prefix)
+	if _, ok := g.alreadyKnown[s]; ok {
+		return g.Generate(prefix)
 	}
-	alreadyKnown[s] = true
+	g.alreadyKnown[s] = true
 	return s
 }
@@ -16,3 +16,15 @@ func TestGen(t *testing.T) {
 	res = gen(370)
 	assert.Equal(t, "AA", res)
 }
+
+func TestGenerator(t *testing.T) {
+	g := New()
+	g.Register("c1")
+	assert.Equal(t, "c2", g.Generate("c"))
+
+	// generators are independent
+	other := New()
+	assert.Equal(t, "c1", other.Generate("c"))
+	assert.Equal(t, 1, other.GetSize())
+	assert.Equal(t, 2, g.GetSize())
+}
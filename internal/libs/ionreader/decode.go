@@ -0,0 +1,168 @@
+package ionreader
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/eadgyo-forked/ion-go/ion"
+)
+
+// Value is a decoded ion value, kept generic so fragments can be inspected
+// without knowing their model
+type Value struct {
+	Name        string
+	Annotations []string
+	Type        ion.Type
+	Text        string
+	Int         int64
+	Float       float64
+	Bool        bool
+	Children    []*Value
+}
+
+// HasAnnotation reports whether the value is annotated with annotation
+func (v *Value) HasAnnotation(annotation string) bool {
+	for _, an := range v.Annotations {
+		if an == annotation {
+			return true
+		}
+	}
+	return false
+}
+
+// Field returns the first child named name, or nil
+func (v *Value) Field(name string) *Value {
+	if v == nil {
+		return nil
+	}
+	for _, child := range v.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// GetText returns the text of a string or symbol value, "" for nil
+func (v *Value) GetText() string {
+	if v == nil {
+		return ""
+	}
+	return v.Text
+}
+
+// GetInt returns the value of an int, 0 for nil
+func (v *Value) GetInt() int64 {
+	if v == nil {
+		return 0
+	}
+	return v.Int
+}
+
+// GetChildren returns the elements of a container, nil for nil
+func (v *Value) GetChildren() []*Value {
+	if v == nil {
+		return nil
+	}
+	return v.Children
+}
+
+// Walk calls fn on the value and all of its descendants
+func (v *Value) Walk(fn func(*Value)) {
+	fn(v)
+	for _, child := range v.Children {
+		child.Walk(fn)
+	}
+}
+
+// Decode reads every top level value of an ion binary payload
+func Decode(ion1 []byte) ([]*Value, error) {
+	return decodeValues(ion.NewReaderBytes(ion1))
+}
+
+func symbolText(token ion.SymbolToken) string {
+	if token.Text != nil {
+		return *token.Text
+	}
+	return "$" + strconv.FormatInt(token.LocalSID, 10)
+}
+
+func decodeValues(reader ion.Reader) ([]*Value, error) {
+	values := []*Value{}
+	for reader.Next() {
+		v := &Value{
+			Type: reader.Type(),
+		}
+
+		name, err := reader.FieldName()
+		if err != nil {
+			return nil, err
+		}
+		if name != nil {
+			v.Name = symbolText(*name)
+		}
+
+		an, err := reader.Annotations()
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range an {
+			v.Annotations = append(v.Annotations, symbolText(a))
+		}
+
+		values = append(values, v)
+		if reader.IsNull() {
+			continue
+		}
+
+		switch v.Type {
+		case ion.SymbolType:
+			a, err := reader.SymbolValue()
+			if err != nil {
+				return nil, err
+			}
+			if a != nil {
+				v.Text = symbolText(*a)
+			}
+		case ion.StringType:
+			val, err := reader.StringValue()
+			if err != nil {
+				return nil, err
+			}
+			v.Text = *val
+		case ion.BoolType:
+			val, err := reader.BoolValue()
+			if err != nil {
+				return nil, err
+			}
+			v.Bool = *val
+		case ion.IntType:
+			val, err := reader.Int64Value()
+			if err != nil {
+				return nil, err
+			}
+			v.Int = *val
+		case ion.FloatType:
+			val, err := reader.FloatValue()
+			if err != nil {
+				return nil, err
+			}
+			v.Float = *val
+		case ion.StructType, ion.ListType, ion.SexpType:
+			if err := reader.StepIn(); err != nil {
+				return nil, err
+			}
+			v.Children, err = decodeValues(reader)
+			if err != nil {
+				return nil, err
+			}
+			if err := reader.StepOut(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unhandled ion type %v", v.Type)
+		}
+	}
+
+	return values, reader.Err()
+}
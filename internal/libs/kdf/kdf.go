@@ -0,0 +1,178 @@
+// Package kdf wraps and unwraps the SQLite database stored as book.kdf in a
+// KPF package.
+//
+// A KDF file is a plain SQLite database in which Kindle tools insert a 1024
+// bytes fingerprint record every megabyte: the first record is placed after
+// the first 1024 bytes of the database (the start of the SQLite header page
+// is left untouched), then another one after each following 1 MiB of database
+// content, as long as there is content left. Every record starts with a fixed
+// signature. Unwrapping removes those records and gives back the SQLite file.
+package kdf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// FingerprintOffset is the position of the first fingerprint record
+	FingerprintOffset = 1024
+	// FingerprintRecordLen is the size of each fingerprint record
+	FingerprintRecordLen = 1024
+	// DataRecordLen is the amount of database content between two records
+	DataRecordLen = 1024 * 1024
+)
+
+// Signature starts every fingerprint record
+var Signature = []byte{0xfa, 0x50, 0x0a, 0x5f}
+
+// fingerprint is the record written by Kindle Create, reused for every
+// position
+var fingerprint = mustDecode(strings.Join([]string{
+	"fa500a5f0100004020ddd75994b7c56c19d8adff59af4dd5a99b8c844d29ea0634cbf4bfe61b9cc4f74d354f9cf73d3aef83c4105892074231f4fcce99dc91e1",
+	"ff0218575c459b62d523bdfebe3188fcde3047406ec4bc21542fa0c6645559e171ddd75958920742e4dffede15bd362bef83c41034cbf4bf71ddd7591e3b506d",
+	"a70511646e1b5a9df74d354f399e153df3e679a5817be72b94b7c56cf3e679a571ddd759c60baec3b52d2b05f74d354fa705116471ddd759531c714965a85bf5",
+	"c60baec3707780f26c7b8454c60baec334cbf4bfc60baec3138d854b15bd362b58920742b52d2b051e3b506da84b07ec34cbf4bf0d4d3cd0bb386639d1f64457",
+	"399e153dd16a935b138d854bf74d354ff74d354fbb386639c60baec3725f3cd3e61b9cc40d4d3cd0a84b07ec94b7c56cf74d354f817be72b71ddd759d1f64457",
+	"3ae34e5ca7051164dd2f7d283ae34e5cf3e679a5ef83c410138d854be25aace0bb386639b52d2b0571ddd759ef83c41071ddd759ed8cc4f7399e153d817be72b",
+	"531c7149f74d354f71ddd7595892074215bd362ba84b07ec6c7b84546c7b845415bd362b3ed5e703f3e679a578e2cd1df74d354fef83c41034cbf4bf67c37d7c",
+	"426d947e34cbf4bfb52d2b05e61b9cc499dc91e1426d947e71ddd7596c7b8454ed8cc4f758920742f74d354f65a85bf534cbf4bf531c714934cbf4bf58920742",
+	"7d0f472f725f3cd39cf73d3a67c37d7ca4b451a0725f3cd371ddd75934cbf4bfbb386639f3e679a5abcd7eb5399e153d707780f271ddd759bb38663934cbf4bf",
+	"3ed5e703138d854b138d854be61b9cc467c37d7ca84b07ec6e1b5a9d426d947e34cbf4bfabcd7eb531f4fcce817be72b707780f2ed8cc4f771ddd759abcd7eb5",
+	"3ed5e703707780f2b52d2b05c60baec3817be72bd1f64457a4b451a0e25aace06e1b5a9dbb3866399cf73d3a58920742e61b9cc4bb3866391e3b506d78e2cd1d",
+	"7d0f472f531c7149817be72bf3e679a56e1b5a9da70511640d4d3cd015bd362b65a85bf5817be72b138d854bbb386639e61b9cc46c7b845471ddd759abcd7eb5",
+	"65a85bf51e3b506dbb386639abcd7eb5707780f26e1b5a9ddd2f7d2834cbf4bfbb38663978e2cd1d0d4d3cd0c3344a3cc3344a3c71ddd759bb386639abcd7eb5",
+	"7d0f472f6e1b5a9dd16a935b31f4fcce6e1b5a9d99dc91e13ae34e5cbb3866397d0f472fa4b451a0c3344a3cd1f64457707780f2817be72b210e6c8f58920742",
+	"34cbf4bf399e153ddd2f7d2834cbf4bf399e153da84b07ec3ed5e703e25aace0bb3866393ed5e7036e1b5a9dbb3866396e1b5a9da4b451a015bd362b6c7b8454",
+	"dd2f7d286e1b5a9d5892074278e2cd1da4b451a0e4dffede9cf73d3aa4b451a031f4fcceb52d2b053ae34e5c3ae34e5c34cbf4bfe4dffede15bd362ba4b45100",
+}, ""))
+
+func mustDecode(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	if len(b) != FingerprintRecordLen || !bytes.HasPrefix(b, Signature) {
+		panic("invalid kdf fingerprint record")
+	}
+	return b
+}
+
+// Fingerprint returns a copy of the record inserted by Wrap
+func Fingerprint() []byte {
+	return bytes.Clone(fingerprint)
+}
+
+// Wrap copies the SQLite database read from r to w, inserting the fingerprint
+// records. The database is streamed, so its size is not limited by memory.
+func Wrap(w io.Writer, r io.Reader) error {
+	br := bufio.NewReader(r)
+
+	n, err := io.CopyN(w, br, FingerprintOffset)
+	if err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("database too small: %d bytes", n)
+		}
+		return err
+	}
+
+	for {
+		// a record is only written if some content follows it
+		if _, err := br.Peek(1); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if _, err := w.Write(fingerprint); err != nil {
+			return err
+		}
+
+		_, err := io.CopyN(w, br, DataRecordLen)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Unwrap copies the KDF read from r to w, removing the fingerprint records.
+// It fails if a record does not start with the expected signature.
+func Unwrap(w io.Writer, r io.Reader) error {
+	br := bufio.NewReader(r)
+
+	n, err := io.CopyN(w, br, FingerprintOffset)
+	if err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("kdf too small: %d bytes", n)
+		}
+		return err
+	}
+
+	record := make([]byte, FingerprintRecordLen)
+	for offset := int64(FingerprintOffset); ; offset += FingerprintRecordLen + DataRecordLen {
+		n, err := io.ReadFull(br, record)
+		if err == io.EOF {
+			return nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("truncated fingerprint record at offset %d: %d bytes", offset, n)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !bytes.HasPrefix(record, Signature) {
+			return fmt.Errorf("missing fingerprint signature at offset %d", offset)
+		}
+
+		_, err = io.CopyN(w, br, DataRecordLen)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// WrapFile wraps the SQLite database inputFile into the KDF outputFile
+func WrapFile(inputFile string, outputFile string) error {
+	return convertFile(inputFile, outputFile, Wrap)
+}
+
+// UnwrapFile extracts the SQLite database of the KDF inputFile into outputFile
+func UnwrapFile(inputFile string, outputFile string) error {
+	return convertFile(inputFile, outputFile, Unwrap)
+}
+
+func convertFile(inputFile string, outputFile string, convert func(io.Writer, io.Reader) error) error {
+	in, err := os.Open(inputFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(out)
+	err = convert(bw, in)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
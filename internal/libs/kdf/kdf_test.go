@@ -0,0 +1,68 @@
+package kdf
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func randomDatabase(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	return data
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	sizes := []int{
+		2048,
+		4096,
+		FingerprintOffset + DataRecordLen,
+		FingerprintOffset + DataRecordLen + 4096,
+		3*DataRecordLen + 4096,
+	}
+
+	for _, size := range sizes {
+		data := randomDatabase(size)
+
+		wrapped := bytes.Buffer{}
+		require.NoError(t, Wrap(&wrapped, bytes.NewReader(data)))
+
+		records := (size - FingerprintOffset + DataRecordLen - 1) / DataRecordLen
+		require.Equal(t, size+records*FingerprintRecordLen, wrapped.Len(), "size %d", size)
+
+		for i := 0; i < records; i++ {
+			offset := FingerprintOffset + i*(FingerprintRecordLen+DataRecordLen)
+			require.Equal(t, fingerprint, wrapped.Bytes()[offset:offset+FingerprintRecordLen], "size %d record %d", size, i)
+		}
+
+		unwrapped := bytes.Buffer{}
+		require.NoError(t, Unwrap(&unwrapped, bytes.NewReader(wrapped.Bytes())))
+		require.Equal(t, data, unwrapped.Bytes(), "size %d", size)
+	}
+}
+
+func TestWrapSmallDatabase(t *testing.T) {
+	data := randomDatabase(4096)
+
+	wrapped := bytes.Buffer{}
+	require.NoError(t, Wrap(&wrapped, bytes.NewReader(data)))
+
+	expected := append([]byte{}, data[:FingerprintOffset]...)
+	expected = append(expected, fingerprint...)
+	expected = append(expected, data[FingerprintOffset:]...)
+	require.Equal(t, expected, wrapped.Bytes())
+
+	require.Error(t, Wrap(&bytes.Buffer{}, bytes.NewReader(data[:512])))
+}
+
+func TestUnwrapInvalid(t *testing.T) {
+	data := randomDatabase(4096)
+
+	require.Error(t, Unwrap(&bytes.Buffer{}, bytes.NewReader(data)))
+
+	wrapped := bytes.Buffer{}
+	require.NoError(t, Wrap(&wrapped, bytes.NewReader(data)))
+	require.Error(t, Unwrap(&bytes.Buffer{}, bytes.NewReader(wrapped.Bytes()[:FingerprintOffset+100])))
+}
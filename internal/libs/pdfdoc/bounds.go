@@ -0,0 +1,473 @@
+package pdfdoc
+
+import (
+	"math"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// Box is a rectangle in points, from the lower left corner of a page
+type Box struct {
+	Left, Bottom, Right, Top float64
+}
+
+func (b Box) IsEmpty() bool {
+	return b.Right <= b.Left || b.Top <= b.Bottom
+}
+
+func (b Box) intersect(o Box) Box {
+	return Box{
+		Left:   math.Max(b.Left, o.Left),
+		Bottom: math.Max(b.Bottom, o.Bottom),
+		Right:  math.Min(b.Right, o.Right),
+		Top:    math.Min(b.Top, o.Top),
+	}
+}
+
+// extent is the smallest box holding points or boxes, which may be flat as
+// for horizontal lines
+type extent struct {
+	box Box
+	ok  bool
+}
+
+func (e *extent) addPoint(x, y float64) {
+	e.addBox(Box{x, y, x, y})
+}
+
+func (e *extent) addBox(b Box) {
+	if !e.ok {
+		e.box, e.ok = b, true
+		return
+	}
+	e.box = Box{
+		Left:   math.Min(e.box.Left, b.Left),
+		Bottom: math.Min(e.box.Bottom, b.Bottom),
+		Right:  math.Max(e.box.Right, b.Right),
+		Top:    math.Max(e.box.Top, b.Top),
+	}
+}
+
+// matrix is an affine transform [a b c d e f], as in the cm operator
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m then n
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return x*m[0] + y*m[2] + m[4], x*m[1] + y*m[3] + m[5]
+}
+
+func argsMatrix(args []pdf.Value) matrix {
+	m := matrix{}
+	for i := range m {
+		m[i] = args[i].Float64()
+	}
+	return m
+}
+
+type graphicsState struct {
+	ctm matrix
+	// whiteFill is set when the fill color is white, so filled backgrounds
+	// are not taken for content
+	whiteFill bool
+	font      pdf.Font
+	fontSize  float64
+	scale     float64
+	leading   float64
+	charSpace float64
+	wordSpace float64
+	// render is the text rendering mode, 3 for invisible text such as the
+	// text layer of a scanned page
+	render int64
+}
+
+// maxFormDepth bounds the nesting of form XObjects, which may draw
+// themselves
+const maxFormDepth = 8
+
+type boundsWalker struct {
+	// resources are the resources of the content stream being walked, the
+	// ones of the page or of a form
+	resources pdf.Value
+	// depth is the number of forms the walker is in
+	depth int
+	g     graphicsState
+	stack []graphicsState
+	tm    matrix
+	tlm   matrix
+	path  extent
+	items []item
+	// area is the displayed area of the page, content outside is hidden
+	area Box
+}
+
+// item is a painted glyph run, path or image
+type item struct {
+	box  Box
+	text bool
+}
+
+// add adds a painted item, clipped to the displayed area
+func (w *boundsWalker) add(painted extent, text bool) {
+	if !painted.ok {
+		return
+	}
+	b := painted.box.intersect(w.area)
+	if b.Right >= b.Left && b.Top >= b.Bottom {
+		w.items = append(w.items, item{box: b, text: text})
+	}
+}
+
+func (w *boundsWalker) addPoint(x, y float64) {
+	w.path.addPoint(w.g.ctm.apply(x, y))
+}
+
+func (w *boundsWalker) addBox(m matrix, b Box, text bool) {
+	painted := extent{}
+	for _, p := range [][2]float64{{b.Left, b.Bottom}, {b.Right, b.Bottom}, {b.Left, b.Top}, {b.Right, b.Top}} {
+		painted.addPoint(m.apply(p[0], p[1]))
+	}
+	w.add(painted, text)
+}
+
+// drawXObject draws the named XObject: an image fills the unit square and a
+// form draws its content through its matrix
+func (w *boundsWalker) drawXObject(name string) {
+	xobject := w.resources.Key("XObject").Key(name)
+	switch xobject.Key("Subtype").Name() {
+	case "Image":
+		w.addBox(w.g.ctm, Box{0, 0, 1, 1}, false)
+		return
+	case "Form":
+	default:
+		return
+	}
+
+	ctm := w.g.ctm
+	if m := xobject.Key("Matrix"); m.Len() == 6 {
+		ctm = argsMatrix([]pdf.Value{m.Index(0), m.Index(1), m.Index(2), m.Index(3), m.Index(4), m.Index(5)}).mul(ctm)
+	}
+	if w.depth >= maxFormDepth {
+		if bbox := xobject.Key("BBox"); bbox.Len() == 4 {
+			w.addBox(ctm, rect(bbox), false)
+		}
+		return
+	}
+
+	resources := xobject.Key("Resources")
+	if resources.Kind() != pdf.Dict {
+		resources = w.resources
+	}
+	form := boundsWalker{
+		resources: resources,
+		depth:     w.depth + 1,
+		g:         w.g,
+		tm:        identity,
+		tlm:       identity,
+		area:      w.area,
+	}
+	form.g.ctm = ctm
+	pdf.Interpret(xobject, form.do)
+	w.items = append(w.items, form.items...)
+}
+
+func (w *boundsWalker) showText(s string) {
+	size := w.g.fontSize
+	trm := matrix{size * w.g.scale, 0, 0, size, 0, 0}.mul(w.tm).mul(w.g.ctm)
+	width := 0.0
+	for i := 0; i < len(s); i++ {
+		glyph := w.g.font.Width(int(s[i]))
+		if glyph == 0 {
+			glyph = 500
+		}
+		advance := glyph/1000*size + w.g.charSpace
+		if s[i] == ' ' {
+			advance += w.g.wordSpace
+		}
+		width += advance * w.g.scale
+	}
+	// a text run of no size or scale, or not painted, shows nothing
+	if width > 0 && size*w.g.scale != 0 && w.g.render != 3 {
+		// glyphs mostly sit between the descender and the cap height
+		w.addBox(trm, Box{0, -0.25, width / (size * w.g.scale), 0.8}, true)
+	}
+	w.tm = matrix{1, 0, 0, 1, width, 0}.mul(w.tm)
+}
+
+func (w *boundsWalker) nextLine(tx, ty float64) {
+	w.tlm = matrix{1, 0, 0, 1, tx, ty}.mul(w.tlm)
+	w.tm = w.tlm
+}
+
+func (w *boundsWalker) paint(fill bool, stroke bool) {
+	if stroke || (fill && !w.g.whiteFill) {
+		w.add(w.path, false)
+	}
+	w.path = extent{}
+}
+
+func isWhite(args []pdf.Value) bool {
+	if len(args) == 0 {
+		return false
+	}
+	for _, arg := range args {
+		if arg.Kind() != pdf.Integer && arg.Kind() != pdf.Real {
+			return false
+		}
+		if arg.Float64() < 0.99 {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *boundsWalker) do(stk *pdf.Stack, op string) {
+	args := make([]pdf.Value, stk.Len())
+	for i := len(args) - 1; i >= 0; i-- {
+		args[i] = stk.Pop()
+	}
+	has := func(n int) bool { return len(args) >= n }
+
+	switch op {
+	case "q":
+		w.stack = append(w.stack, w.g)
+	case "Q":
+		if n := len(w.stack); n > 0 {
+			w.g = w.stack[n-1]
+			w.stack = w.stack[:n-1]
+		}
+	case "cm":
+		if has(6) {
+			w.g.ctm = argsMatrix(args).mul(w.g.ctm)
+		}
+
+	case "g", "rg":
+		w.g.whiteFill = isWhite(args)
+	case "k":
+		w.g.whiteFill = has(4) && args[0].Float64() == 0 && args[1].Float64() == 0 && args[2].Float64() == 0 && args[3].Float64() == 0
+	case "sc", "scn":
+		w.g.whiteFill = (len(args) == 1 || len(args) == 3) && isWhite(args)
+
+	case "m", "l":
+		if has(2) {
+			w.addPoint(args[0].Float64(), args[1].Float64())
+		}
+	case "c":
+		if has(6) {
+			w.addPoint(args[0].Float64(), args[1].Float64())
+			w.addPoint(args[2].Float64(), args[3].Float64())
+			w.addPoint(args[4].Float64(), args[5].Float64())
+		}
+	case "v", "y":
+		if has(4) {
+			w.addPoint(args[0].Float64(), args[1].Float64())
+			w.addPoint(args[2].Float64(), args[3].Float64())
+		}
+	case "re":
+		if has(4) {
+			x, y, width, height := args[0].Float64(), args[1].Float64(), args[2].Float64(), args[3].Float64()
+			w.addPoint(x, y)
+			w.addPoint(x+width, y+height)
+			w.addPoint(x+width, y)
+			w.addPoint(x, y+height)
+		}
+	case "S", "s":
+		w.paint(false, true)
+	case "f", "F", "f*":
+		w.paint(true, false)
+	case "B", "B*", "b", "b*":
+		w.paint(true, true)
+	case "n":
+		// clipping paths are not painted
+		w.path = extent{}
+
+	case "Do":
+		if has(1) {
+			w.drawXObject(args[0].Name())
+		}
+
+	case "BT":
+		w.tm = identity
+		w.tlm = identity
+	case "Tf":
+		if has(2) {
+			w.g.font = pdf.Font{V: w.resources.Key("Font").Key(args[0].Name())}
+			w.g.fontSize = args[1].Float64()
+		}
+	case "Tz":
+		if has(1) {
+			w.g.scale = args[0].Float64() / 100
+		}
+	case "TL":
+		if has(1) {
+			w.g.leading = args[0].Float64()
+		}
+	case "Tc":
+		if has(1) {
+			w.g.charSpace = args[0].Float64()
+		}
+	case "Tw":
+		if has(1) {
+			w.g.wordSpace = args[0].Float64()
+		}
+	case "Tr":
+		if has(1) {
+			w.g.render = args[0].Int64()
+		}
+	case "Td":
+		if has(2) {
+			w.nextLine(args[0].Float64(), args[1].Float64())
+		}
+	case "TD":
+		if has(2) {
+			w.g.leading = -args[1].Float64()
+			w.nextLine(args[0].Float64(), args[1].Float64())
+		}
+	case "Tm":
+		if has(6) {
+			w.tlm = argsMatrix(args)
+			w.tm = w.tlm
+		}
+	case "T*":
+		w.nextLine(0, -w.g.leading)
+	case "Tj":
+		if has(1) {
+			w.showText(args[0].RawString())
+		}
+	case "'":
+		w.nextLine(0, -w.g.leading)
+		if has(1) {
+			w.showText(args[0].RawString())
+		}
+	case "\"":
+		if has(3) {
+			w.g.wordSpace = args[0].Float64()
+			w.g.charSpace = args[1].Float64()
+			w.nextLine(0, -w.g.leading)
+			w.showText(args[2].RawString())
+		}
+	case "TJ":
+		if has(1) {
+			array := args[0]
+			for i := 0; i < array.Len(); i++ {
+				v := array.Index(i)
+				if v.Kind() == pdf.String {
+					w.showText(v.RawString())
+				} else {
+					tx := -v.Float64() / 1000 * w.g.fontSize * w.g.scale
+					w.tm = matrix{1, 0, 0, 1, tx, 0}.mul(w.tm)
+				}
+			}
+		}
+	}
+}
+
+// ContentBounds returns the box holding the text, the paths and the images
+// drawn on a 0 based page, from the lower left corner of its displayed area.
+// It returns false for blank pages, rotated pages and unreadable content.
+func (d *Document) ContentBounds(i int) (Box, bool) {
+	items, ok := d.items(i)
+	if !ok {
+		return Box{}, false
+	}
+
+	bounds := extent{}
+	for _, it := range items {
+		bounds.addBox(it.box)
+	}
+	if bounds.box.IsEmpty() {
+		return Box{}, false
+	}
+	return bounds.box, true
+}
+
+// items returns the items painted on a 0 based page, from the lower left
+// corner of its displayed area
+func (d *Document) items(i int) (items []item, ok bool) {
+	defer func() {
+		// the pdf reader panics on malformed content streams
+		if r := recover(); r != nil {
+			items, ok = nil, false
+		}
+	}()
+
+	page := d.Reader.Page(i + 1)
+	area, ok := displayedArea(page.V)
+	if !ok {
+		return nil, false
+	}
+
+	w := boundsWalker{
+		resources: page.Resources(),
+		g: graphicsState{
+			ctm:   identity,
+			scale: 1,
+		},
+		tm:   identity,
+		tlm:  identity,
+		area: area,
+	}
+
+	contents := page.V.Key("Contents")
+	if contents.Kind() == pdf.Array {
+		for j := 0; j < contents.Len(); j++ {
+			pdf.Interpret(contents.Index(j), w.do)
+		}
+	} else {
+		pdf.Interpret(contents, w.do)
+	}
+
+	for j := range w.items {
+		w.items[j].box = w.items[j].box.relativeTo(area)
+	}
+	return w.items, len(w.items) > 0
+}
+
+// displayedArea returns the crop box, or else the media box, of a page. It
+// returns false for rotated pages, whose content is not upright.
+func displayedArea(page pdf.Value) (Box, bool) {
+	if inherited(page, "Rotate").Int64()%360 != 0 {
+		return Box{}, false
+	}
+
+	visible := inherited(page, "CropBox")
+	if visible.Len() != 4 {
+		visible = inherited(page, "MediaBox")
+	}
+	if visible.Len() != 4 {
+		return Box{}, false
+	}
+	return rect(visible), true
+}
+
+// rect reads a pdf rectangle, whose corners may come in any order
+func rect(v pdf.Value) Box {
+	return Box{
+		Left:   math.Min(v.Index(0).Float64(), v.Index(2).Float64()),
+		Bottom: math.Min(v.Index(1).Float64(), v.Index(3).Float64()),
+		Right:  math.Max(v.Index(0).Float64(), v.Index(2).Float64()),
+		Top:    math.Max(v.Index(1).Float64(), v.Index(3).Float64()),
+	}
+}
+
+// relativeTo moves a box to the coordinates of an area
+func (b Box) relativeTo(area Box) Box {
+	return Box{
+		Left:   b.Left - area.Left,
+		Bottom: b.Bottom - area.Bottom,
+		Right:  b.Right - area.Left,
+		Top:    b.Top - area.Bottom,
+	}
+}
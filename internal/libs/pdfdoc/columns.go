@@ -0,0 +1,183 @@
+package pdfdoc
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// minGutter is the narrowest blank between two columns, in points
+	minGutter = 6
+	// minColumnLines is the least text items on each side of the gutter
+	minColumnLines = 5
+	// minColumnHeight is the least part of the content height in columns
+	minColumnHeight = 0.4
+)
+
+// Columns detects a two column layout from the text and the images of a 0
+// based page. It returns the regions of the page in reading order: the full
+// width header above the columns if any, the left column, the right column,
+// then the full width footer if any. It returns false for single column
+// pages and pages where a figure or a text spans both columns in the middle.
+func (d *Document) Columns(i int) ([]Box, bool) {
+	items, ok := d.items(i)
+	if !ok {
+		return nil, false
+	}
+
+	bounds := extent{}
+	for _, it := range items {
+		bounds.addBox(it.box)
+	}
+	content := bounds.box
+	if content.IsEmpty() {
+		return nil, false
+	}
+
+	gutter, ok := findGutter(items, content)
+	if !ok {
+		return nil, false
+	}
+
+	// items crossing the gutter are full width, the columns are the tallest
+	// band without any of them
+	crossing := [][2]float64{}
+	for _, it := range items {
+		if it.box.Left < gutter.Right && it.box.Right > gutter.Left {
+			crossing = append(crossing, [2]float64{it.box.Bottom, it.box.Top})
+		}
+	}
+	bottom, top := tallestFreeBand(crossing, content.Bottom, content.Top)
+	if top-bottom < minColumnHeight*(content.Top-content.Bottom) {
+		return nil, false
+	}
+
+	left, right := extent{}, extent{}
+	header, footer := extent{}, extent{}
+	// columns above or below the band mean a figure interrupts them
+	inside, above, below := sides{}, sides{}, sides{}
+	for _, it := range items {
+		b := it.box
+		switch {
+		case b.Bottom >= top:
+			header.addBox(b)
+			above.count(it, gutter)
+		case b.Top <= bottom:
+			footer.addBox(b)
+			below.count(it, gutter)
+		case b.Right <= gutter.Left:
+			left.addBox(b)
+			inside.count(it, gutter)
+		case b.Left >= gutter.Right:
+			right.addBox(b)
+			inside.count(it, gutter)
+		default:
+			// a full width item partly in the band
+			return nil, false
+		}
+	}
+	if !inside.isColumns() || above.isColumns() || below.isColumns() {
+		return nil, false
+	}
+
+	regions := []Box{}
+	if header.ok {
+		regions = append(regions, Box{content.Left, header.box.Bottom, content.Right, header.box.Top})
+	}
+	regions = append(regions, left.box, right.box)
+	if footer.ok {
+		regions = append(regions, Box{content.Left, footer.box.Bottom, content.Right, footer.box.Top})
+	}
+	return regions, true
+}
+
+// sides counts the text items on each side of the gutter
+type sides struct {
+	left, right int
+}
+
+func (s *sides) count(it item, gutter Box) {
+	switch {
+	case !it.text:
+	case it.box.Right <= gutter.Left:
+		s.left++
+	case it.box.Left >= gutter.Right:
+		s.right++
+	}
+}
+
+func (s sides) isColumns() bool {
+	return s.left >= minColumnLines && s.right >= minColumnLines
+}
+
+// findGutter returns the widest vertical blank in the middle of the content
+// crossed by the fewest items, give or take a few stray items such as a
+// centered page number
+func findGutter(items []item, content Box) (Box, bool) {
+	width := content.Right - content.Left
+	from := content.Left + 0.35*width
+	to := content.Left + 0.65*width
+
+	// count the items covering each point of the middle
+	steps := int(math.Ceil(to - from))
+	if steps <= 0 {
+		return Box{}, false
+	}
+	coverage := make([]int, steps)
+	for _, it := range items {
+		first := int(math.Max(0, math.Floor(it.box.Left-from)))
+		last := int(math.Min(float64(steps-1), math.Ceil(it.box.Right-from)))
+		for x := first; x <= last; x++ {
+			coverage[x]++
+		}
+	}
+
+	least := len(items)
+	for _, c := range coverage {
+		least = min(least, c)
+	}
+	tolerated := least + max(1, len(items)/50)
+
+	best, bestWidth := -1, 0
+	for x := 0; x < steps; {
+		if coverage[x] > tolerated {
+			x++
+			continue
+		}
+		start := x
+		for x < steps && coverage[x] <= tolerated {
+			x++
+		}
+		if x-start > bestWidth {
+			best, bestWidth = start, x-start
+		}
+	}
+	if best < 0 || bestWidth < minGutter {
+		return Box{}, false
+	}
+
+	return Box{
+		Left:   from + float64(best),
+		Bottom: content.Bottom,
+		Right:  from + float64(best+bestWidth),
+		Top:    content.Top,
+	}, true
+}
+
+// tallestFreeBand returns the tallest band between bottom and top that no
+// interval covers
+func tallestFreeBand(intervals [][2]float64, bottom, top float64) (float64, float64) {
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i][0] < intervals[j][0]
+	})
+
+	bestBottom, bestTop := 0.0, 0.0
+	cursor := bottom
+	for _, interval := range append(intervals, [2]float64{top, top}) {
+		if interval[0] > cursor && interval[0]-cursor > bestTop-bestBottom {
+			bestBottom, bestTop = cursor, interval[0]
+		}
+		cursor = math.Max(cursor, interval[1])
+	}
+	return bestBottom, bestTop
+}
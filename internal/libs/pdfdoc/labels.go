@@ -0,0 +1,108 @@
+package pdfdoc
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// labelRange numbers the pages from its first one up to the next range
+type labelRange struct {
+	first  int
+	style  string
+	prefix string
+	start  int
+}
+
+// PageLabels returns the printed label of each page, such as "iv", "A-3" or
+// "127", read from the /PageLabels number tree of the catalog. It returns nil
+// when the document has no page labels.
+func (d *Document) PageLabels() []string {
+	ranges := []labelRange{}
+	collectLabelRanges(d.Reader.Trailer().Key("Root").Key("PageLabels"), &ranges, 0)
+	if len(ranges) == 0 {
+		return nil
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].first < ranges[j].first })
+
+	labels := make([]string, d.numPage)
+	for i, r := range ranges {
+		last := d.numPage
+		if i+1 < len(ranges) {
+			last = min(last, ranges[i+1].first)
+		}
+		for page := max(r.first, 0); page < last; page++ {
+			labels[page] = r.prefix + formatLabel(r.style, r.start+page-r.first)
+		}
+	}
+	return labels
+}
+
+// collectLabelRanges walks a number tree, depth guarding against loops
+func collectLabelRanges(node pdf.Value, ranges *[]labelRange, depth int) {
+	if node.Kind() != pdf.Dict || depth > 32 {
+		return
+	}
+
+	nums := node.Key("Nums")
+	for i := 0; i+1 < nums.Len(); i += 2 {
+		label := nums.Index(i + 1)
+		start := 1
+		if st := label.Key("St"); st.Kind() == pdf.Integer && st.Int64() > 0 {
+			start = int(st.Int64())
+		}
+		*ranges = append(*ranges, labelRange{
+			first:  int(nums.Index(i).Int64()),
+			style:  label.Key("S").Name(),
+			prefix: label.Key("P").Text(),
+			start:  start,
+		})
+	}
+
+	kids := node.Key("Kids")
+	for i := 0; i < kids.Len(); i++ {
+		collectLabelRanges(kids.Index(i), ranges, depth+1)
+	}
+}
+
+// formatLabel formats a page number in a page label style: D for decimal,
+// R and r for roman numerals, A and a for letters. Pages without a style only
+// get the prefix.
+func formatLabel(style string, n int) string {
+	switch style {
+	case "D":
+		return strconv.Itoa(n)
+	case "R":
+		return roman(n)
+	case "r":
+		return strings.ToLower(roman(n))
+	case "A":
+		return letters(n)
+	case "a":
+		return strings.ToLower(letters(n))
+	}
+	return ""
+}
+
+func roman(n int) string {
+	values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	symbols := []string{"M", "CM", "D", "CD", "C", "XC", "L", "XL", "X", "IX", "V", "IV", "I"}
+	b := strings.Builder{}
+	for i, v := range values {
+		for ; n >= v; n -= v {
+			b.WriteString(symbols[i])
+		}
+	}
+	return b.String()
+}
+
+// letters numbers pages A to Z, then AA to ZZ, then AAA and so on
+func letters(n int) string {
+	if n < 1 {
+		return ""
+	}
+	letter := string(rune('A' + (n-1)%26))
+	return strings.Repeat(letter, (n-1)/26+1)
+}
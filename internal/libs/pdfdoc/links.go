@@ -0,0 +1,57 @@
+package pdfdoc
+
+// Link is a link annotation of a page
+type Link struct {
+	// Box is the clickable region, from the lower left corner of the
+	// displayed area of the page
+	Box Box
+	// PageIndex is the 0 based page targeted by an internal link, -1 for an
+	// external one
+	PageIndex int
+	// URI is the target of an external link
+	URI string
+}
+
+// Links returns the links of a 0 based page pointing at a page of the
+// document or at a URI, clipped to its displayed area. Links of rotated pages
+// and links to other documents are left out.
+func (d *Document) Links(i int) (links []Link) {
+	defer func() {
+		// the pdf reader panics on malformed objects
+		if r := recover(); r != nil {
+			links = nil
+		}
+	}()
+
+	page := d.Reader.Page(i + 1).V
+	area, ok := displayedArea(page)
+	if !ok {
+		return nil
+	}
+
+	annots := page.Key("Annots")
+	for j := 0; j < annots.Len(); j++ {
+		annot := annots.Index(j)
+		if annot.Key("Subtype").Name() != "Link" || annot.Key("Rect").Len() != 4 {
+			continue
+		}
+		box := rect(annot.Key("Rect")).intersect(area)
+		if box.IsEmpty() {
+			continue
+		}
+
+		link := Link{Box: box.relativeTo(area), PageIndex: -1}
+		if dest := annot.Key("Dest"); !dest.IsNull() {
+			link.PageIndex, ok = d.ResolveDest(dest)
+		} else if action := annot.Key("A"); action.Key("S").Name() == "URI" {
+			link.URI = action.Key("URI").RawString()
+			ok = link.URI != ""
+		} else {
+			link.PageIndex, ok = d.ResolveAction(action)
+		}
+		if ok {
+			links = append(links, link)
+		}
+	}
+	return links
+}
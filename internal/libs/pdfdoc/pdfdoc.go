@@ -0,0 +1,221 @@
+// Package pdfdoc resolves the parts of a PDF document that refer to pages:
+// outline entries, destinations, links and page labels. The pdf reader only
+// exposes page numbers, so page objects are indexed by their content.
+package pdfdoc
+
+import (
+	"encoding/hex"
+	"regexp"
+
+	"github.com/ledongthuc/pdf"
+)
+
+type Document struct {
+	Reader      *pdf.Reader
+	pageIndexes map[string]int
+	numPage     int
+}
+
+type OutlineEntry struct {
+	Title string
+	// PageIndex is the 0 based page the entry points to, -1 if unresolved
+	PageIndex int
+	Children  []OutlineEntry
+}
+
+func New(r *pdf.Reader) *Document {
+	d := Document{
+		Reader:      r,
+		pageIndexes: map[string]int{},
+	}
+	d.indexPages(r.Trailer().Key("Root").Key("Pages"))
+	return &d
+}
+
+func (d *Document) indexPages(node pdf.Value) {
+	kids := node.Key("Kids")
+	for i := 0; i < kids.Len(); i++ {
+		kid := kids.Index(i)
+		switch kid.Key("Type").Name() {
+		case "Pages":
+			d.indexPages(kid)
+		case "Page":
+			key := kid.String()
+			if _, exists := d.pageIndexes[key]; !exists {
+				d.pageIndexes[key] = d.numPage
+			}
+			d.numPage++
+		}
+	}
+}
+
+// ID returns the permanent identifier of the document, the first entry of the
+// /ID of its trailer in hex, empty when missing
+func (d *Document) ID() string {
+	return hex.EncodeToString([]byte(d.Reader.Trailer().Key("ID").Index(0).RawString()))
+}
+
+func (d *Document) NumPage() int {
+	return d.numPage
+}
+
+// PageIndex returns the 0 based index of a page object
+func (d *Document) PageIndex(page pdf.Value) (int, bool) {
+	if page.Kind() == pdf.Integer {
+		// some producers write the page number instead of a reference
+		i := int(page.Int64())
+		return i, i >= 0 && i < d.numPage
+	}
+	i, exists := d.pageIndexes[page.String()]
+	return i, exists
+}
+
+// ResolveDest returns the page index of an explicit or named destination
+func (d *Document) ResolveDest(dest pdf.Value) (int, bool) {
+	switch dest.Kind() {
+	case pdf.Array:
+		return d.PageIndex(dest.Index(0))
+	case pdf.Dict:
+		return d.ResolveDest(dest.Key("D"))
+	case pdf.Name:
+		return d.ResolveDest(d.namedDest(dest.Name()))
+	case pdf.String:
+		return d.ResolveDest(d.namedDest(dest.RawString()))
+	}
+	return -1, false
+}
+
+// ResolveAction returns the page index targeted by a GoTo action
+func (d *Document) ResolveAction(action pdf.Value) (int, bool) {
+	if action.Key("S").Name() != "GoTo" {
+		return -1, false
+	}
+	return d.ResolveDest(action.Key("D"))
+}
+
+func (d *Document) namedDest(name string) pdf.Value {
+	root := d.Reader.Trailer().Key("Root")
+
+	// PDF 1.1 dictionary of names
+	if dest := root.Key("Dests").Key(name); !dest.IsNull() {
+		return dest
+	}
+
+	// PDF 1.2 name tree
+	return lookupNameTree(root.Key("Names").Key("Dests"), name)
+}
+
+func lookupNameTree(node pdf.Value, name string) pdf.Value {
+	names := node.Key("Names")
+	for i := 0; i+1 < names.Len(); i += 2 {
+		if names.Index(i).RawString() == name {
+			return names.Index(i + 1)
+		}
+	}
+
+	kids := node.Key("Kids")
+	for i := 0; i < kids.Len(); i++ {
+		kid := kids.Index(i)
+		limits := kid.Key("Limits")
+		if limits.Len() == 2 && (name < limits.Index(0).RawString() || name > limits.Index(1).RawString()) {
+			continue
+		}
+		if v := lookupNameTree(kid, name); !v.IsNull() {
+			return v
+		}
+	}
+	return pdf.Value{}
+}
+
+// Outline returns the top level outline entries with their pages
+func (d *Document) Outline() []OutlineEntry {
+	return d.outlineChildren(d.Reader.Trailer().Key("Root").Key("Outlines"), map[string]bool{})
+}
+
+func (d *Document) outlineChildren(entry pdf.Value, seen map[string]bool) []OutlineEntry {
+	entries := []OutlineEntry{}
+	for child := entry.Key("First"); child.Kind() == pdf.Dict; child = child.Key("Next") {
+		// broken files may link entries in a loop
+		key := child.String()
+		if seen[key] {
+			break
+		}
+		seen[key] = true
+
+		pageIndex, ok := d.ResolveDest(child.Key("Dest"))
+		if !ok {
+			pageIndex, ok = d.ResolveAction(child.Key("A"))
+		}
+		if !ok {
+			pageIndex = -1
+		}
+
+		entries = append(entries, OutlineEntry{
+			Title:     child.Key("Title").Text(),
+			PageIndex: pageIndex,
+			Children:  d.outlineChildren(child, seen),
+		})
+	}
+	return entries
+}
+
+func inherited(page pdf.Value, key string) pdf.Value {
+	for v := page; v.Kind() == pdf.Dict; v = v.Key("Parent") {
+		if r := v.Key(key); !r.IsNull() {
+			return r
+		}
+	}
+	return pdf.Value{}
+}
+
+// PageSize returns the displayed width and height in points of a 0 based
+// page: its crop box, or else its media box, turned by its rotation
+func (d *Document) PageSize(i int) (float64, float64, bool) {
+	page := d.Reader.Page(i + 1).V
+	box := inherited(page, "CropBox")
+	if box.Len() != 4 {
+		box = inherited(page, "MediaBox")
+	}
+	if box.Len() != 4 {
+		return 0, 0, false
+	}
+
+	width := box.Index(2).Float64() - box.Index(0).Float64()
+	height := box.Index(3).Float64() - box.Index(1).Float64()
+	if width < 0 {
+		width = -width
+	}
+	if height < 0 {
+		height = -height
+	}
+	if width == 0 || height == 0 {
+		return 0, 0, false
+	}
+
+	if rotate := inherited(page, "Rotate").Int64(); rotate%180 != 0 {
+		width, height = height, width
+	}
+	return width, height, true
+}
+
+// startTitle matches the titles of the outline entries where the body of a
+// book starts
+var startTitle = regexp.MustCompile(`(?i)^\s*((chapter|chapitre|part|partie)\s+(1|one|i|un|une)\b|(introduction|prologue)\b|1[.:)]?\s)`)
+
+// StartPage returns the 0 based page of the first outline entry starting the
+// body of the book, such as "Chapter 1" or "Introduction"
+func (d *Document) StartPage() (int, bool) {
+	return startPage(d.Outline())
+}
+
+func startPage(entries []OutlineEntry) (int, bool) {
+	for _, entry := range entries {
+		if entry.PageIndex >= 0 && startTitle.MatchString(entry.Title) {
+			return entry.PageIndex, true
+		}
+		if i, ok := startPage(entry.Children); ok {
+			return i, true
+		}
+	}
+	return -1, false
+}
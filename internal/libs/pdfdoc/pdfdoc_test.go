@@ -0,0 +1,358 @@
+package pdfdoc
+
+import (
+	"bytes"
+	"pdf_raw_printing/internal/libs/pdftest"
+	"strings"
+	"testing"
+
+	"github.com/ledongthuc/pdf"
+	"github.com/stretchr/testify/require"
+)
+
+func open(t *testing.T, doc pdftest.Document) *Document {
+	b := doc.Bytes()
+	r, err := pdf.NewReader(bytes.NewReader(b), int64(len(b)))
+	require.NoError(t, err)
+	return New(r)
+}
+
+func TestOutline(t *testing.T) {
+	d := open(t, pdftest.Document{
+		Pages: []pdftest.Page{{}, {}, {}, {}},
+		Outline: []pdftest.OutlineEntry{
+			{Title: "Introduction", Page: 0},
+			{Title: "Chapter 1", Page: 1, Children: []pdftest.OutlineEntry{
+				{Title: "Section 1.1", Page: 2},
+			}},
+			{Title: "Chapter 2", Page: 3},
+		},
+	})
+
+	require.Equal(t, 4, d.NumPage())
+	require.Equal(t, []OutlineEntry{
+		{Title: "Introduction", PageIndex: 0, Children: []OutlineEntry{}},
+		{Title: "Chapter 1", PageIndex: 1, Children: []OutlineEntry{
+			{Title: "Section 1.1", PageIndex: 2, Children: []OutlineEntry{}},
+		}},
+		{Title: "Chapter 2", PageIndex: 3, Children: []OutlineEntry{}},
+	}, d.Outline())
+}
+
+func TestResolveDest(t *testing.T) {
+	d := open(t, pdftest.Document{
+		Pages: []pdftest.Page{
+			{
+				Annots: []string{
+					"<< /Type /Annot /Subtype /Link /Rect [0 0 10 10] /Dest [{page 2} /XYZ 0 0 0] >>",
+					"<< /Type /Annot /Subtype /Link /Rect [0 0 10 10] /Dest /intro >>",
+					"<< /Type /Annot /Subtype /Link /Rect [0 0 10 10] /Dest (tree) >>",
+					"<< /Type /Annot /Subtype /Link /Rect [0 0 10 10] /A << /S /GoTo /D [{page 1} /Fit] >> >>",
+					"<< /Type /Annot /Subtype /Link /Rect [0 0 10 10] /Dest /unknown >>",
+				},
+			},
+			{},
+			{},
+		},
+		Catalog: "/Dests << /intro [{page 1} /Fit] >> /Names << /Dests << /Names [(tree) << /D [{page 2} /Fit] >>] >> >>",
+	})
+
+	annots := d.Reader.Page(1).V.Key("Annots")
+	require.Equal(t, 5, annots.Len())
+
+	for i, expected := range []int{2, 1, 2} {
+		pageIndex, ok := d.ResolveDest(annots.Index(i).Key("Dest"))
+		require.True(t, ok, "annotation %d", i)
+		require.Equal(t, expected, pageIndex, "annotation %d", i)
+	}
+
+	pageIndex, ok := d.ResolveAction(annots.Index(3).Key("A"))
+	require.True(t, ok)
+	require.Equal(t, 1, pageIndex)
+
+	_, ok = d.ResolveDest(annots.Index(4).Key("Dest"))
+	require.False(t, ok)
+}
+
+func TestPageSize(t *testing.T) {
+	d := open(t, pdftest.Document{
+		Pages: []pdftest.Page{
+			{},
+			{Width: 612, Height: 792},
+			{Width: 612, Height: 792, Extra: "/Rotate 90"},
+			{Width: 612, Height: 792, Extra: "/CropBox [10 20 310 420]"},
+		},
+	})
+
+	sizes := [][2]float64{}
+	for i := 0; i < d.NumPage(); i++ {
+		width, height, ok := d.PageSize(i)
+		require.True(t, ok)
+		sizes = append(sizes, [2]float64{width, height})
+	}
+	require.Equal(t, [][2]float64{{595, 842}, {612, 792}, {792, 612}, {300, 400}}, sizes)
+}
+
+func TestContentBounds(t *testing.T) {
+	d := open(t, pdftest.Document{
+		Pages: []pdftest.Page{
+			// text
+			{Texts: []pdftest.Text{{X: 100, Y: 700, Size: 10, Text: "abcd"}}},
+			// a stroked line, a white background and a clipping path
+			{Content: "1 g 0 0 595 842 re f 0 g 0 0 595 842 re W n 50 60 m 150 260 l S"},
+			// an image drawn through the transformation matrix
+			{Content: "q 200 0 0 100 300 400 cm /Im0 Do Q", Images: 1},
+			// nothing
+			{},
+			// text positioned by Tm, outside of the crop box on the right
+			{Content: "BT /F1 10 Tf 1 0 0 1 50 50 Tm (a) Tj 1 0 0 1 1000 50 Tm (b) Tj ET", Extra: "/CropBox [10 10 500 800]"},
+		},
+	})
+
+	box, ok := d.ContentBounds(0)
+	require.True(t, ok)
+	require.InDelta(t, 100, box.Left, 0.01)
+	require.InDelta(t, 697.5, box.Bottom, 0.01)
+	require.Greater(t, box.Right, 110.0)
+	require.Less(t, box.Right, 130.0)
+	require.InDelta(t, 708, box.Top, 0.01)
+
+	box, ok = d.ContentBounds(1)
+	require.True(t, ok)
+	require.InDelta(t, 50, box.Left, 0.01)
+	require.InDelta(t, 60, box.Bottom, 0.01)
+	require.InDelta(t, 150, box.Right, 0.01)
+	require.InDelta(t, 260, box.Top, 0.01)
+
+	box, ok = d.ContentBounds(2)
+	require.True(t, ok)
+	require.InDelta(t, 300, box.Left, 0.01)
+	require.InDelta(t, 400, box.Bottom, 0.01)
+	require.InDelta(t, 500, box.Right, 0.01)
+	require.InDelta(t, 500, box.Top, 0.01)
+
+	_, ok = d.ContentBounds(3)
+	require.False(t, ok)
+
+	box, ok = d.ContentBounds(4)
+	require.True(t, ok)
+	require.InDelta(t, 40, box.Left, 0.01)
+	require.InDelta(t, 37.5, box.Bottom, 0.01)
+	require.Less(t, box.Right, 50.0)
+}
+
+func TestContentBoundsHiddenText(t *testing.T) {
+	d := open(t, pdftest.Document{
+		Pages: []pdftest.Page{
+			// a font size of 0, the character spacing still moving the glyphs
+			{Content: "BT /F1 0 Tf 2 Tc 100 100 Td (abcd) Tj ET"},
+			// a horizontal scale of 0
+			{Content: "BT /F1 10 Tf 0 Tz 2 Tc 100 100 Td (abcd) Tj ET"},
+			// the invisible text of a scanned page, then visible text
+			{Content: "BT /F1 10 Tf 3 Tr 100 100 Td (abcd) Tj 0 Tr 0 200 Td (a) Tj ET"},
+		},
+	})
+
+	_, ok := d.ContentBounds(0)
+	require.False(t, ok)
+	_, ok = d.ContentBounds(1)
+	require.False(t, ok)
+
+	box, ok := d.ContentBounds(2)
+	require.True(t, ok)
+	require.InDelta(t, 297.5, box.Bottom, 0.01)
+	require.InDelta(t, 308, box.Top, 0.01)
+}
+
+func TestContentBoundsForms(t *testing.T) {
+	d := open(t, pdftest.Document{
+		Pages: []pdftest.Page{
+			// the whole page drawn by a form with an identity transform
+			{Content: "/Fm0 Do", Forms: []pdftest.Form{{
+				BBox:    "0 0 595 842",
+				Texts:   []pdftest.Text{{X: 100, Y: 700, Size: 10, Text: "abcd"}},
+				Content: "0 g 100 100 300 200 re f",
+			}}},
+			// a form moved by its matrix and by the transformation matrix
+			{Content: "q 1 0 0 1 100 0 cm /Fm0 Do Q", Forms: []pdftest.Form{{
+				BBox:    "0 0 100 100",
+				Matrix:  "2 0 0 2 0 50",
+				Content: "0 g 10 10 20 20 re f",
+			}}},
+			// a form drawing itself
+			{Content: "/Fm0 Do", Forms: []pdftest.Form{{
+				BBox:             "0 0 50 50",
+				Content:          "0 g 10 10 20 20 re f /Fm0 Do",
+				InheritResources: true,
+			}}},
+		},
+	})
+
+	box, ok := d.ContentBounds(0)
+	require.True(t, ok)
+	require.InDelta(t, 100, box.Left, 0.01)
+	require.InDelta(t, 100, box.Bottom, 0.01)
+	require.Greater(t, box.Right, 400.0-0.01)
+	require.InDelta(t, 708, box.Top, 0.01)
+
+	box, ok = d.ContentBounds(1)
+	require.True(t, ok)
+	require.InDelta(t, 120, box.Left, 0.01)
+	require.InDelta(t, 70, box.Bottom, 0.01)
+	require.InDelta(t, 160, box.Right, 0.01)
+	require.InDelta(t, 110, box.Top, 0.01)
+
+	box, ok = d.ContentBounds(2)
+	require.True(t, ok)
+	require.InDelta(t, 0, box.Left, 0.01)
+	require.InDelta(t, 50, box.Top, 0.01)
+}
+
+func TestColumns(t *testing.T) {
+	// 40 characters of 10 points are 200 points wide
+	line := strings.Repeat("a", 40)
+	wide := strings.Repeat("a", 90)
+
+	twoColumns := func(extra string) pdftest.Page {
+		page := pdftest.Page{Content: extra}
+		page.Texts = append(page.Texts, pdftest.Text{X: 50, Y: 780, Size: 10, Text: wide})
+		for y := 700.0; y > 200; y -= 20 {
+			page.Texts = append(page.Texts,
+				pdftest.Text{X: 50, Y: y, Size: 10, Text: line},
+				pdftest.Text{X: 320, Y: y, Size: 10, Text: line},
+			)
+		}
+		page.Texts = append(page.Texts, pdftest.Text{X: 290, Y: 50, Size: 10, Text: "12"})
+		return page
+	}
+
+	singleColumn := pdftest.Page{}
+	for y := 700.0; y > 200; y -= 20 {
+		singleColumn.Texts = append(singleColumn.Texts, pdftest.Text{X: 50, Y: y, Size: 10, Text: wide})
+	}
+
+	d := open(t, pdftest.Document{
+		Pages: []pdftest.Page{
+			twoColumns(""),
+			singleColumn,
+			// a figure across both columns in the middle of the page
+			twoColumns("0 g 50 400 470 100 re f"),
+			{},
+		},
+	})
+
+	regions, ok := d.Columns(0)
+	require.True(t, ok)
+	require.Len(t, regions, 4)
+	header, left, right, footer := regions[0], regions[1], regions[2], regions[3]
+	require.InDelta(t, 777.5, header.Bottom, 0.01)
+	require.InDelta(t, 50, left.Left, 0.01)
+	require.InDelta(t, 250, left.Right, 0.01)
+	require.InDelta(t, 708, left.Top, 0.01)
+	require.InDelta(t, 217.5, left.Bottom, 0.01)
+	require.InDelta(t, 320, right.Left, 0.01)
+	require.InDelta(t, 520, right.Right, 0.01)
+	require.InDelta(t, 58, footer.Top, 0.01)
+	require.InDelta(t, header.Left, footer.Left, 0.01)
+
+	_, ok = d.Columns(1)
+	require.False(t, ok)
+
+	_, ok = d.Columns(2)
+	require.False(t, ok)
+
+	_, ok = d.Columns(3)
+	require.False(t, ok)
+}
+
+func TestPageLabels(t *testing.T) {
+	d := open(t, pdftest.Document{
+		Pages: make([]pdftest.Page, 8),
+		Catalog: "/PageLabels << /Kids [" +
+			"<< /Nums [0 << /S /r /St 3 >> 2 << /S /A /P (A-) >>] >> " +
+			"<< /Nums [4 << /S /D /St 127 >> 6 << /P (Cover) >> 7 << /S /a /St 27 >>] >>" +
+			"] >>",
+	})
+
+	require.Equal(t, []string{"iii", "iv", "A-A", "A-B", "127", "128", "Cover", "aa"}, d.PageLabels())
+
+	d = open(t, pdftest.Document{Pages: []pdftest.Page{{}}})
+	require.Nil(t, d.PageLabels())
+}
+
+func TestLinks(t *testing.T) {
+	d := open(t, pdftest.Document{
+		Pages: []pdftest.Page{
+			{
+				Extra: "/CropBox [10 10 500 800]",
+				Annots: []string{
+					"<< /Type /Annot /Subtype /Link /Rect [100 200 50 150] /Dest [{page 2} /Fit] >>",
+					"<< /Type /Annot /Subtype /Link /Rect [450 700 600 720] /A << /S /URI /URI (https://example.com/) >> >>",
+					"<< /Type /Annot /Subtype /Link /Rect [60 60 80 80] /A << /S /GoTo /D [{page 1} /Fit] >> >>",
+					// outside of the crop box, to another document and not a link
+					"<< /Type /Annot /Subtype /Link /Rect [0 0 5 5] /Dest [{page 1} /Fit] >>",
+					"<< /Type /Annot /Subtype /Link /Rect [60 60 80 80] /A << /S /GoToR /F (other.pdf) /D [0 /Fit] >> >>",
+					"<< /Type /Annot /Subtype /Text /Rect [60 60 80 80] >>",
+				},
+			},
+			{},
+			{Extra: "/Rotate 90", Annots: []string{"<< /Type /Annot /Subtype /Link /Rect [0 0 10 10] /Dest [{page 0} /Fit] >>"}},
+		},
+	})
+
+	require.Equal(t, []Link{
+		{Box: Box{40, 140, 90, 190}, PageIndex: 2},
+		{Box: Box{440, 690, 490, 710}, PageIndex: -1, URI: "https://example.com/"},
+		{Box: Box{50, 50, 70, 70}, PageIndex: 1},
+	}, d.Links(0))
+	require.Empty(t, d.Links(1))
+	require.Empty(t, d.Links(2))
+}
+
+func TestStartPage(t *testing.T) {
+	d := open(t, pdftest.Document{
+		Pages: []pdftest.Page{{}, {}, {}, {}, {}},
+		Outline: []pdftest.OutlineEntry{
+			{Title: "Cover", Page: 0},
+			{Title: "Contents", Page: 1},
+			{Title: "Part One", Page: 2, Children: []pdftest.OutlineEntry{
+				{Title: "Chapter 1: Beginnings", Page: 3},
+			}},
+			{Title: "Introduction", Page: 4},
+		},
+	})
+	page, ok := d.StartPage()
+	require.True(t, ok)
+	require.Equal(t, 2, page)
+
+	d = open(t, pdftest.Document{
+		Pages: []pdftest.Page{{}, {}, {}},
+		Outline: []pdftest.OutlineEntry{
+			{Title: "Preface", Page: 0},
+			{Title: "Chapters", Page: 1, Children: []pdftest.OutlineEntry{
+				{Title: "1. Getting started", Page: 2},
+			}},
+		},
+	})
+	page, ok = d.StartPage()
+	require.True(t, ok)
+	require.Equal(t, 2, page)
+
+	d = open(t, pdftest.Document{
+		Pages:   []pdftest.Page{{}, {}},
+		Outline: []pdftest.OutlineEntry{{Title: "10 tips", Page: 1}, {Title: "Index", Page: 1}},
+	})
+	_, ok = d.StartPage()
+	require.False(t, ok)
+}
+
+func TestID(t *testing.T) {
+	d := open(t, pdftest.Document{
+		Pages:   []pdftest.Page{{}},
+		Trailer: "/ID [<0123ABCD> <FFFF>]",
+	})
+	require.Equal(t, "0123abcd", d.ID())
+
+	d = open(t, pdftest.Document{Pages: []pdftest.Page{{}}})
+	require.Equal(t, "", d.ID())
+}
@@ -0,0 +1,216 @@
+// Package pdftest writes small PDF documents for tests, so fixtures can be
+// described in code instead of being checked in as binaries.
+package pdftest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type Text struct {
+	X, Y float64
+	Size float64
+	Text string
+}
+
+type Page struct {
+	// Width and Height default to A4 portrait
+	Width, Height float64
+	Texts         []Text
+	// Content is appended as is to the page content stream
+	Content string
+	// Annots are raw annotation dictionaries, where "{page N}" is replaced by
+	// a reference to the Nth page (0 based)
+	Annots []string
+	// Extra holds raw extra entries of the page dictionary
+	Extra string
+	// Images is the number of 1x1 images of the page, drawn with /ImN Do
+	Images int
+	// Forms are the form XObjects of the page, drawn with /FmN Do
+	Forms []Form
+}
+
+// Form is a form XObject, its content being drawn in its own space
+type Form struct {
+	// BBox is the raw bounding box, such as "0 0 100 100"
+	BBox string
+	// Matrix is the raw form matrix, identity when empty
+	Matrix  string
+	Texts   []Text
+	Content string
+	// InheritResources leaves out the resources of the form, which uses the
+	// ones of the page
+	InheritResources bool
+}
+
+type OutlineEntry struct {
+	Title    string
+	Page     int
+	Children []OutlineEntry
+}
+
+type Document struct {
+	Pages   []Page
+	Outline []OutlineEntry
+	// Catalog holds raw extra entries of the document catalog
+	Catalog string
+	// Trailer holds raw extra entries of the trailer
+	Trailer string
+}
+
+type writer struct {
+	objects []string
+}
+
+func (w *writer) reserve() int {
+	w.objects = append(w.objects, "")
+	return len(w.objects)
+}
+
+func (w *writer) set(id int, object string) {
+	w.objects[id-1] = object
+}
+
+func (w *writer) add(object string) int {
+	id := w.reserve()
+	w.set(id, object)
+	return id
+}
+
+func ref(id int) string {
+	return fmt.Sprintf("%d 0 R", id)
+}
+
+// Bytes writes the document
+func (d Document) Bytes() []byte {
+	w := writer{}
+	catalog := w.reserve()
+	pages := w.reserve()
+	font := w.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>")
+
+	pageIds := make([]int, len(d.Pages))
+	for i := range d.Pages {
+		pageIds[i] = w.reserve()
+	}
+
+	resolvePages := func(s string) string {
+		for i, id := range pageIds {
+			s = strings.ReplaceAll(s, fmt.Sprintf("{page %d}", i), ref(id))
+		}
+		return s
+	}
+
+	kids := []string{}
+	for i, page := range d.Pages {
+		width, height := page.Width, page.Height
+		if width == 0 {
+			width, height = 595, 842
+		}
+
+		content := contentStream(page.Texts, page.Content)
+		contentId := w.add(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+
+		xobjects := []string{}
+		for j := 0; j < page.Images; j++ {
+			id := w.add("<< /Type /XObject /Subtype /Image /Width 1 /Height 1 /ColorSpace /DeviceGray /BitsPerComponent 8 /Length 1 >>\nstream\n\x00\nendstream")
+			xobjects = append(xobjects, fmt.Sprintf("/Im%d %s", j, ref(id)))
+		}
+		for j, form := range page.Forms {
+			entries := ""
+			if form.Matrix != "" {
+				entries = " /Matrix [" + form.Matrix + "]"
+			}
+			if !form.InheritResources {
+				entries += fmt.Sprintf(" /Resources << /Font << /F1 %s >> >>", ref(font))
+			}
+			formContent := contentStream(form.Texts, form.Content)
+			id := w.add(fmt.Sprintf("<< /Type /XObject /Subtype /Form /BBox [%s]%s /Length %d >>\nstream\n%s\nendstream",
+				form.BBox, entries, len(formContent), formContent))
+			xobjects = append(xobjects, fmt.Sprintf("/Fm%d %s", j, ref(id)))
+		}
+		resources := fmt.Sprintf("/Font << /F1 %s >>", ref(font))
+		if len(xobjects) > 0 {
+			resources += " /XObject << " + strings.Join(xobjects, " ") + " >>"
+		}
+
+		annots := ""
+		if len(page.Annots) > 0 {
+			ids := []string{}
+			for _, annot := range page.Annots {
+				ids = append(ids, ref(w.add(resolvePages(annot))))
+			}
+			annots = " /Annots [" + strings.Join(ids, " ") + "]"
+		}
+
+		w.set(pageIds[i], fmt.Sprintf("<< /Type /Page /Parent %s /MediaBox [0 0 %g %g] /Resources << %s >> /Contents %s%s %s >>",
+			ref(pages), width, height, resources, ref(contentId), annots, page.Extra))
+		kids = append(kids, ref(pageIds[i]))
+	}
+	w.set(pages, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.Pages)))
+
+	outlines := ""
+	if len(d.Outline) > 0 {
+		root := w.reserve()
+		first, last := w.addOutline(d.Outline, root, pageIds)
+		w.set(root, fmt.Sprintf("<< /Type /Outlines /First %s /Last %s /Count %d >>", ref(first), ref(last), len(d.Outline)))
+		outlines = " /Outlines " + ref(root)
+	}
+
+	w.set(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %s%s %s >>", ref(pages), outlines, resolvePages(d.Catalog)))
+
+	out := bytes.Buffer{}
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(w.objects))
+	for i, object := range w.objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(w.objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %s %s >>\nstartxref\n%d\n%%%%EOF\n", len(w.objects)+1, ref(catalog), d.Trailer, xref)
+
+	return out.Bytes()
+}
+
+// contentStream shows the texts with the font F1, then appends the raw content
+func contentStream(texts []Text, raw string) string {
+	content := strings.Builder{}
+	for _, t := range texts {
+		size := t.Size
+		if size == 0 {
+			size = 12
+		}
+		fmt.Fprintf(&content, "BT /F1 %g Tf %g %g Td (%s) Tj ET\n", size, t.X, t.Y, t.Text)
+	}
+	content.WriteString(raw)
+	return content.String()
+}
+
+func (w *writer) addOutline(entries []OutlineEntry, parent int, pageIds []int) (int, int) {
+	ids := make([]int, len(entries))
+	for i := range entries {
+		ids[i] = w.reserve()
+	}
+
+	for i, entry := range entries {
+		object := fmt.Sprintf("<< /Title (%s) /Parent %s /Dest [%s /Fit]", entry.Title, ref(parent), ref(pageIds[entry.Page]))
+		if i > 0 {
+			object += " /Prev " + ref(ids[i-1])
+		}
+		if i < len(entries)-1 {
+			object += " /Next " + ref(ids[i+1])
+		}
+		if len(entry.Children) > 0 {
+			first, last := w.addOutline(entry.Children, ids[i], pageIds)
+			object += fmt.Sprintf(" /First %s /Last %s /Count %d", ref(first), ref(last), len(entry.Children))
+		}
+		w.set(ids[i], object+" >>")
+	}
+
+	return ids[0], ids[len(ids)-1]
+}
@@ -847,8 +847,13 @@ func (d Ion_Symbol) String() string {
 	return Items_symbols_string[d-1]
 }
 
+// LocalSymbols are the symbols of a book that are not YJ symbols, declared
+// after them by the $ion_symbol_table fragment of the book
+var LocalSymbols = []string{"root_entity"}
+
 func AllItemsSymbols() []string {
-	return Items_symbols_string
+	symbols := append([]string{}, Items_symbols_string...)
+	return append(symbols, LocalSymbols...)
 }
 
 func CreateCatalog() ion.Catalog {
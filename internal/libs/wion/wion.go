@@ -12,7 +12,7 @@ import (
 var regValue = regexp.MustCompile(`^(.*?)(,|$)`)
 var regOption = regexp.MustCompile(`^(\w+)=(.*?)$`)
 
-var ItemSharedSymbols ion.SharedSymbolTable = ion.NewSharedSymbolTable("$ion", 1, Items_symbols_string)
+var ItemSharedSymbols ion.SharedSymbolTable = ion.NewSharedSymbolTable("$ion", 1, AllItemsSymbols())
 
 func init() {
 	ion.V1SystemSymbolTable = ion.NewSharedSymbolTable("$ion", 1, AllItemsSymbols())
@@ -22,6 +22,7 @@ type Wion struct {
 	name       string
 	typeWion   string
 	annotation string
+	omit       string
 }
 
 func extractWions(content string) (*Wion, error) {
@@ -52,6 +53,8 @@ func extractWions(content string) (*Wion, error) {
 			w.typeWion = options[2]
 		case "annotation":
 			w.annotation = options[2]
+		case "omit":
+			w.omit = options[2]
 		default:
 			return nil, fmt.Errorf("unrecognized option type")
 		}
@@ -161,6 +164,18 @@ func writeElement(writer ion.Writer, vt reflect.Value, wion *Wion) error {
 		return nil
 	}
 
+	// omit=empty skips empty slices, like nav units without children, and
+	// zero values
+	if wion.omit == "empty" {
+		if vt.Kind() == reflect.Slice || vt.Kind() == reflect.Array {
+			if vt.Len() == 0 {
+				return nil
+			}
+		} else if vt.IsZero() {
+			return nil
+		}
+	}
+
 	if wion.name != "" {
 		must(writer.FieldName(getAnnotation(wion.name)))
 	}
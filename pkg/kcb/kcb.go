@@ -0,0 +1,181 @@
+// Package kcb reads and writes KCB files, the json Kindle Create project at
+// the root of a kpf package describing how the book is read.
+package kcb
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// TimeLayout is the format of the dates of a KCB
+const TimeLayout = "2006-Jan-02 15:04:05"
+
+// Time is a date of a KCB, the empty string when zero
+type Time struct {
+	time.Time
+}
+
+func (t Time) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return json.Marshal("")
+	}
+	return json.Marshal(t.UTC().Format(TimeLayout))
+}
+
+func (t *Time) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+	parsed, err := time.Parse(TimeLayout, s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+// ReadingDirection is the page turn direction of a book
+type ReadingDirection int
+
+const (
+	LeftToRight ReadingDirection = 0
+	RightToLeft ReadingDirection = 1
+)
+
+// PanelMovement is how the virtual panels of a comic are moved through
+type PanelMovement int
+
+const (
+	PanelMovementNone       PanelMovement = 0
+	PanelMovementHorizontal PanelMovement = 1
+	PanelMovementVertical   PanelMovement = 2
+)
+
+// ParsePanelMovement parses none, horizontal or vertical, none when empty
+func ParsePanelMovement(s string) (PanelMovement, error) {
+	switch s {
+	case "", "none":
+		return PanelMovementNone, nil
+	case "horizontal":
+		return PanelMovementHorizontal, nil
+	case "vertical":
+		return PanelMovementVertical, nil
+	}
+	return PanelMovementNone, fmt.Errorf("invalid panel movement %q, expected none, horizontal or vertical", s)
+}
+
+type KCB struct {
+	BookState BookState `json:"book_state"`
+	// ContentHash is the hash of the resources of the book, null when unknown
+	ContentHash *string  `json:"content_hash"`
+	Metadata    Metadata `json:"metadata"`
+	ToolData    ToolData `json:"tool_data"`
+}
+
+type BookState struct {
+	InputType            int              `json:"book_input_type"`
+	MangaComic           bool             `json:"book_manga_comic"`
+	ReadingDirection     ReadingDirection `json:"book_reading_direction"`
+	TargetType           int              `json:"book_target_type"`
+	VirtualPanelMovement PanelMovement    `json:"book_virtual_panelmovement"`
+}
+
+type Metadata struct {
+	// BookPath is the folder of the book.kdf in the package
+	BookPath           string   `json:"book_path"`
+	EditedToolVersions []string `json:"edited_tool_versions"`
+	Format             string   `json:"format"`
+	GlobalStyling      bool     `json:"global_styling"`
+	// Id is the book id
+	Id          string `json:"id"`
+	Platform    string `json:"platform"`
+	ToolName    string `json:"tool_name"`
+	ToolVersion string `json:"tool_version"`
+}
+
+type ToolData struct {
+	CachePath                  string `json:"cache_path"`
+	CreatedOn                  Time   `json:"created_on"`
+	LastModifiedTime           Time   `json:"last_modified_time"`
+	LinkExtractChoice          bool   `json:"link_extract_choice"`
+	LinkNotificationPreference bool   `json:"link_notification_preference"`
+}
+
+// New returns the KCB of a pdf book made by Kindle Create 1.96 on a mac
+func New() KCB {
+	return KCB{
+		BookState: BookState{
+			InputType:  1,
+			TargetType: 1,
+		},
+		Metadata: Metadata{
+			BookPath:           "resources",
+			EditedToolVersions: []string{"1.93.0.0", "1.96.0.0"},
+			Format:             "yj",
+			GlobalStyling:      true,
+			Platform:           "mac",
+			ToolName:           "KC",
+			ToolVersion:        "1.96.0.0",
+		},
+		ToolData: ToolData{
+			CachePath:                  "resources/.cache",
+			LinkNotificationPreference: true,
+		},
+	}
+}
+
+// Marshal returns the indented json of a KCB
+func (k KCB) Marshal() ([]byte, error) {
+	return json.MarshalIndent(k, "", "\t")
+}
+
+// Parse parses the json of a KCB
+func Parse(b []byte) (KCB, error) {
+	k := KCB{}
+	if err := json.Unmarshal(b, &k); err != nil {
+		return KCB{}, fmt.Errorf("kcb: %w", err)
+	}
+	return k, nil
+}
+
+// Read parses the KCB read from r
+func Read(r io.Reader) (KCB, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return KCB{}, err
+	}
+	return Parse(b)
+}
+
+// ReadKPF parses the KCB at the root of a kpf package
+func ReadKPF(kpfpath string) (KCB, error) {
+	archive, err := zip.OpenReader(kpfpath)
+	if err != nil {
+		return KCB{}, err
+	}
+	defer archive.Close()
+
+	for _, f := range archive.File {
+		if path.Dir(f.Name) != "." || !strings.HasSuffix(f.Name, ".kcb") {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return KCB{}, err
+		}
+		defer r.Close()
+		return Read(r)
+	}
+	return KCB{}, errors.New("no kcb in the kpf")
+}
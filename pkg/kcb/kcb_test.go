@@ -0,0 +1,97 @@
+package kcb
+
+import (
+	"archive/zip"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// project is a KCB as written by Kindle Create
+const project = `{
+	"book_state" : {
+		"book_input_type" : 1,
+		"book_manga_comic" : true,
+		"book_reading_direction" : 1,
+		"book_target_type" : 1,
+		"book_virtual_panelmovement" : 2
+	},
+	"content_hash" : null,
+	"metadata" : {
+		"book_path" : "resources",
+		"edited_tool_versions" : [ "1.93.0.0", "1.96.0.0" ],
+		"format" : "yj",
+		"global_styling" : true,
+		"id" : "a7c5b0c2-3f5e-4d3f-9a29-8a8c0e4d5a36",
+		"platform" : "windows",
+		"tool_name" : "KC",
+		"tool_version" : "1.96.0.0"
+	},
+	"tool_data" : {
+		"cache_path" : "resources/.cache",
+		"created_on" : "2023-Nov-14 22:13:20",
+		"last_modified_time" : "2023-Nov-15 08:00:00",
+		"link_extract_choice" : false,
+		"link_notification_preference" : true
+	}
+}`
+
+func TestParse(t *testing.T) {
+	k, err := Parse([]byte(project))
+	require.NoError(t, err)
+	require.True(t, k.BookState.MangaComic)
+	require.Equal(t, RightToLeft, k.BookState.ReadingDirection)
+	require.Equal(t, PanelMovementVertical, k.BookState.VirtualPanelMovement)
+	require.Nil(t, k.ContentHash)
+	require.Equal(t, "windows", k.Metadata.Platform)
+	require.Equal(t, time.Unix(1700000000, 0).UTC(), k.ToolData.CreatedOn.Time)
+
+	// marshalling gives back the same project
+	b, err := k.Marshal()
+	require.NoError(t, err)
+	require.JSONEq(t, project, string(b))
+
+	_, err = Parse([]byte(`{"tool_data": {"created_on": "yesterday"}}`))
+	require.Error(t, err)
+}
+
+func TestNew(t *testing.T) {
+	b, err := New().Marshal()
+	require.NoError(t, err)
+	k, err := Parse(b)
+	require.NoError(t, err)
+	require.Equal(t, New(), k)
+	require.Contains(t, string(b), `"created_on": ""`)
+}
+
+func TestReadKPF(t *testing.T) {
+	kpfPath := path.Join(t.TempDir(), "book.kpf")
+	f, err := os.Create(kpfPath)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	_, err = w.Create("resources/book.kdf")
+	require.NoError(t, err)
+	entry, err := w.Create("mybook.kcb")
+	require.NoError(t, err)
+	_, err = entry.Write([]byte(project))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	k, err := ReadKPF(kpfPath)
+	require.NoError(t, err)
+	require.Equal(t, "a7c5b0c2-3f5e-4d3f-9a29-8a8c0e4d5a36", k.Metadata.Id)
+}
+
+func TestParsePanelMovement(t *testing.T) {
+	for s, expected := range map[string]PanelMovement{"": PanelMovementNone, "none": PanelMovementNone, "horizontal": PanelMovementHorizontal, "vertical": PanelMovementVertical} {
+		movement, err := ParsePanelMovement(s)
+		require.NoError(t, err)
+		require.Equal(t, expected, movement)
+	}
+	_, err := ParsePanelMovement("diagonal")
+	require.Error(t, err)
+}
@@ -0,0 +1,272 @@
+// Package kindlepdf converts pdfs to Kindle books, as kpf packages read by the
+// KFX Output plugin of calibre or as bare kdf databases.
+//
+// The pdfs are embedded as they are and each page, or each view of a page, is
+// shown as a fixed layout page, keeping the outline, the links and the page
+// labels of the pdfs.
+package kindlepdf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"pdf_raw_printing/internal/business"
+	"pdf_raw_printing/internal/libs/kdf"
+	"pdf_raw_printing/pkg/kcb"
+	"strings"
+	"time"
+)
+
+// Format is the format of the converted book
+type Format string
+
+const (
+	// FormatKPF is a kpf package, the book.kdf with the pdfs and the files
+	// describing the book
+	FormatKPF Format = "kpf"
+	// FormatKDF is the book.kdf alone, the pdfs are not embedded
+	FormatKDF Format = "kdf"
+)
+
+// Options are the options of a conversion, the zero value of each one keeping
+// the default behaviour
+type Options struct {
+	// Title and Author of the book, the title of the outline of the pdf when
+	// empty
+	Title  string
+	Author string
+	// BookId pins the book id, so a new conversion replaces the book on the
+	// device. It is derived from the content of the pdfs when empty, or from
+	// their /ID with BookIdFromDocument.
+	BookId             string
+	BookIdFromDocument bool
+
+	// Pages are the 0 based pages of the pdf in the book, in order and each
+	// one once, every page when empty
+	Pages []int
+	// Cover is an optional jpg or png image shown ahead of the pages
+	Cover io.ReaderAt
+	// Crop are the margins to crop, such as 36, 5%,10% or
+	// odd:36,72,36,36;even:36,36,36,72
+	Crop string
+	// AutoCrop crops the white margins around the content of each page (page)
+	// or of the whole document (document), keeping CropPadding points
+	AutoCrop    string
+	CropPadding float64
+	// Views splits each page into views: halves, columns or RxC such as 3x2,
+	// each view showing ViewsOverlap percent of its neighbours, from 0 to less
+	// than 100
+	Views        string
+	ViewsOverlap float64
+	ViewsRTL     bool
+	// Columns shows each column of the two column pages as its own view, the
+	// other pages being kept whole. It can't be used with Views.
+	Columns bool
+	// Direction is the reading direction, ltr or rtl, ltr when empty
+	Direction string
+	// Comic marks the book as a manga or a comic
+	Comic bool
+	// CoverPage and StartPage are the 1 based pages marked as the cover and
+	// where reading starts, 0 when not set. When merging, the pages are
+	// numbered across the pdfs in order.
+	CoverPage int
+	StartPage int
+	// SourceDate clamps the timestamps of the book, as SOURCE_DATE_EPOCH,
+	// unless zero
+	SourceDate time.Time
+	// PanelMovement, Platform, ToolVersion, CreatedOn and ModifiedOn are the
+	// settings of the Kindle Create project of a kpf, see package kcb. The
+	// defaults of Kindle Create 1.96 on a mac and the timestamp of the book
+	// are kept for the zero values.
+	PanelMovement kcb.PanelMovement
+	Platform      string
+	ToolVersion   string
+	CreatedOn     time.Time
+	ModifiedOn    time.Time
+
+	// Format of the book, FormatKPF when empty
+	Format Format
+	// TempDir is where the SQLite database of the book is built, the default
+	// directory for temporary files when empty. The database is removed once
+	// the book is written, the pdfs and the cover being read from their
+	// readers.
+	TempDir string
+	// Output receives the book
+	Output io.Writer
+}
+
+// Result describes a converted book
+type Result struct {
+	BookId    string
+	Title     string
+	Author    string
+	Timestamp time.Time
+}
+
+// Document is a pdf merged into a book, Name being its file name
+type Document struct {
+	Reader io.ReaderAt
+	Name   string
+}
+
+// Convert converts the pages of a pdf to a book written to opts.Output. The
+// size of src is read from a Size or a Stat method, as on bytes.Reader,
+// io.SectionReader and os.File.
+func Convert(ctx context.Context, src io.ReaderAt, opts Options) (Result, error) {
+	return convert(ctx, []Document{{Reader: src}}, opts)
+}
+
+// Merge converts every page of the pdfs, in order, to one book written to
+// opts.Output, the table of contents having one entry per pdf
+func Merge(ctx context.Context, docs []Document, opts Options) (Result, error) {
+	if len(docs) == 0 {
+		return Result{}, errors.New("no pdf to merge")
+	}
+	if len(opts.Pages) > 0 {
+		return Result{}, errors.New("pages can't be selected when merging pdfs")
+	}
+	return convert(ctx, docs, opts)
+}
+
+// Validate checks the integrity of a kpf or, for a .kdf path, of a kdf
+func Validate(bookpath string) error {
+	if strings.HasSuffix(bookpath, ".kdf") {
+		return business.ValidateKDF(bookpath)
+	}
+	return business.ValidateKPF(bookpath)
+}
+
+func convert(ctx context.Context, docs []Document, opts Options) (Result, error) {
+	if opts.Output == nil {
+		return Result{}, errors.New("no output")
+	}
+	format := opts.Format
+	if format == "" {
+		format = FormatKPF
+	}
+	if format != FormatKPF && format != FormatKDF {
+		return Result{}, fmt.Errorf("invalid format %q, expected kpf or kdf", format)
+	}
+	direction, err := business.ParseDirection(opts.Direction)
+	if err != nil {
+		return Result{}, err
+	}
+	pageOpts, err := newPageOptions(opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	dir, err := os.MkdirTemp(opts.TempDir, "kindlepdf-")
+	if err != nil {
+		return Result{}, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	pdfInfo := business.PDFInfo{
+		Title:          opts.Title,
+		Autor:          opts.Author,
+		Direction:      direction,
+		Comic:          opts.Comic,
+		Id:             opts.BookId,
+		IdFromDocument: opts.BookIdFromDocument,
+		SourceDate:     opts.SourceDate,
+		Project: business.ProjectOptions{
+			PanelMovement: opts.PanelMovement,
+			Platform:      opts.Platform,
+			ToolVersion:   opts.ToolVersion,
+			CreatedOn:     opts.CreatedOn,
+			ModifiedOn:    opts.ModifiedOn,
+		},
+	}
+
+	for i, d := range docs {
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+		source, err := readSource(i, d, pageOpts, opts.Pages)
+		if err != nil {
+			return Result{}, err
+		}
+		pdfInfo.Sources = append(pdfInfo.Sources, source)
+	}
+	if err := markPages(pdfInfo.Sources, pageOpts); err != nil {
+		return Result{}, err
+	}
+
+	if pdfInfo.Title == "" {
+		pdfInfo.Title = pdfInfo.Sources[0].Title
+	}
+	if pdfInfo.Autor == "" {
+		pdfInfo.Autor = pdfInfo.Sources[0].Title
+	}
+
+	if opts.Cover != nil {
+		info, err := readInfo(opts.Cover)
+		if err != nil {
+			return Result{}, err
+		}
+		cover, err := business.NewCoverReader(opts.Cover, business.ResourceName(len(pdfInfo.Sources)), info)
+		if err != nil {
+			return Result{}, err
+		}
+		pdfInfo.Cover = &cover
+	}
+
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	if err := business.CreateNewPDF(pdfInfo, dir); err != nil {
+		return Result{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	if format == FormatKDF {
+		err = writeKDF(opts.Output, path.Join(dir, "temp.db"))
+	} else {
+		err = business.WriteKPF(opts.Output, pdfInfo, path.Join(dir, "temp.db"))
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		BookId:    pdfInfo.BookId(),
+		Title:     pdfInfo.Title,
+		Author:    pdfInfo.Autor,
+		Timestamp: pdfInfo.Timestamp(),
+	}, nil
+}
+
+// readSource describes the i-th pdf of a book, of which pages are converted
+func readSource(i int, d Document, opts pageOptions, pages []int) (business.Source, error) {
+	doc, err := openDocument(d.Reader)
+	if err != nil {
+		return business.Source{}, err
+	}
+	info, err := readInfo(d.Reader)
+	if err != nil {
+		return business.Source{}, err
+	}
+	source, err := newSource(d, info, i, doc, opts, pages)
+	if err != nil {
+		return business.Source{}, err
+	}
+	if source.Title == "" && d.Name != "" {
+		source.Title = trimExt(d.Name)
+	}
+	return source, nil
+}
+
+func writeKDF(w io.Writer, dbpath string) error {
+	f, err := os.Open(dbpath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	return kdf.Wrap(w, f)
+}
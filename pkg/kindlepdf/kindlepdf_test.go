@@ -0,0 +1,203 @@
+package kindlepdf
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"pdf_raw_printing/internal/business"
+	"pdf_raw_printing/internal/libs/pdftest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func fixture(pages int) *bytes.Reader {
+	d := pdftest.Document{}
+	for i := 0; i < pages; i++ {
+		d.Pages = append(d.Pages, pdftest.Page{Texts: []pdftest.Text{{X: 100, Y: 700, Size: 20, Text: "page"}}})
+	}
+	for i, page := range []int{1, 3} {
+		if page < pages {
+			d.Outline = append(d.Outline, pdftest.OutlineEntry{Title: fmt.Sprintf("Chapter %d", i+1), Page: page})
+		}
+	}
+	return bytes.NewReader(d.Bytes())
+}
+
+func TestConvert(t *testing.T) {
+	out := bytes.Buffer{}
+	result, err := Convert(context.Background(), fixture(4), Options{Title: "title", Output: &out, TempDir: t.TempDir()})
+	require.NoError(t, err)
+	require.Equal(t, "title", result.Title)
+	require.NotEmpty(t, result.BookId)
+
+	kpfPath := path.Join(t.TempDir(), "book.kpf")
+	require.NoError(t, os.WriteFile(kpfPath, out.Bytes(), 0666))
+	require.NoError(t, Validate(kpfPath))
+
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	require.NoError(t, err)
+	names := []string{}
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	require.Contains(t, names, "resources/book.kdf")
+	require.Contains(t, names, "resources/res/rsrc1")
+}
+
+func TestConvertKDF(t *testing.T) {
+	out := bytes.Buffer{}
+	_, err := Convert(context.Background(), fixture(2), Options{Pages: []int{1}, Format: FormatKDF, Output: &out})
+	require.NoError(t, err)
+
+	kdfPath := path.Join(t.TempDir(), "book.kdf")
+	require.NoError(t, os.WriteFile(kdfPath, out.Bytes(), 0666))
+	require.NoError(t, Validate(kdfPath))
+}
+
+func TestConvertErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Convert(ctx, fixture(1), Options{Output: &bytes.Buffer{}})
+	require.Equal(t, context.Canceled, err)
+
+	_, err = Convert(context.Background(), fixture(1), Options{})
+	require.Error(t, err)
+
+	_, err = Convert(context.Background(), fixture(1), Options{Pages: []int{1}, Output: &bytes.Buffer{}})
+	require.Error(t, err)
+
+	_, err = Convert(context.Background(), fixture(1), Options{Format: "epub", Output: &bytes.Buffer{}})
+	require.Error(t, err)
+
+	_, err = Convert(context.Background(), fixture(1), Options{Columns: true, Views: "halves", Output: &bytes.Buffer{}})
+	require.Error(t, err)
+
+	for _, overlap := range []float64{-5, 100, 150} {
+		_, err = Convert(context.Background(), fixture(1), Options{Views: "halves", ViewsOverlap: overlap, Output: &bytes.Buffer{}})
+		require.Error(t, err, overlap)
+	}
+
+	// the size of a bare io.ReaderAt is unknown
+	_, err = Convert(context.Background(), struct{ io.ReaderAt }{fixture(1)}, Options{Output: &bytes.Buffer{}})
+	require.Error(t, err)
+	src := fixture(1)
+	_, err = Convert(context.Background(), io.NewSectionReader(src, 0, src.Size()), Options{Output: &bytes.Buffer{}})
+	require.NoError(t, err)
+}
+
+func TestMerge(t *testing.T) {
+	out := bytes.Buffer{}
+	result, err := Merge(context.Background(), []Document{
+		{Reader: fixture(1), Name: "first.pdf"},
+		{Reader: fixture(2), Name: "second.pdf"},
+	}, Options{Output: &out})
+	require.NoError(t, err)
+	require.Equal(t, "first", result.Title)
+
+	// the cover page is a page of the book, not of each pdf
+	_, err = Merge(context.Background(), []Document{
+		{Reader: fixture(1), Name: "first.pdf"},
+		{Reader: fixture(2), Name: "second.pdf"},
+	}, Options{CoverPage: 3, Output: &bytes.Buffer{}})
+	require.NoError(t, err)
+
+	_, err = Merge(context.Background(), nil, Options{Output: &out})
+	require.Error(t, err)
+}
+
+func TestVolumes(t *testing.T) {
+	volumes, err := Volumes(fixture(5), VolumeOptions{Every: 2})
+	require.NoError(t, err)
+	require.Equal(t, []Volume{{Title: "Volume 1", Pages: []int{0, 1}}, {Title: "Volume 2", Pages: []int{2, 3}}, {Title: "Volume 3", Pages: []int{4}}}, volumes)
+
+	// the volumes are titled after the pdf when its outline has no title
+	volumes, err = Volumes(fixture(3), VolumeOptions{Every: 2, Name: "dir/book.pdf"})
+	require.NoError(t, err)
+	require.Equal(t, []Volume{{Title: "book 1", Pages: []int{0, 1}}, {Title: "book 2", Pages: []int{2}}}, volumes)
+
+	volumes, err = Volumes(fixture(5), VolumeOptions{Pages: "2-", ByOutline: true})
+	require.NoError(t, err)
+	require.Equal(t, []Volume{{Title: "Chapter 1", Pages: []int{1, 2}}, {Title: "Chapter 2", Pages: []int{3, 4}}}, volumes)
+
+	// a page is in the book once
+	_, err = Volumes(fixture(5), VolumeOptions{Pages: "1-5,3"})
+	require.Error(t, err)
+}
+
+func TestNewSourceSelectedPages(t *testing.T) {
+	src := fixture(3)
+	doc, err := openDocument(src)
+	require.NoError(t, err)
+	opts, err := newPageOptions(Options{AutoCrop: "page", Columns: true})
+	require.NoError(t, err)
+
+	// only the content of the selected pages is read
+	source, err := newSource(Document{Reader: src}, business.ResourceInfo{}, 0, doc, opts, []int{1})
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, source.Pages)
+	require.Len(t, source.ContentBounds, 3)
+	require.True(t, source.ContentBounds[0].IsEmpty())
+	require.False(t, source.ContentBounds[1].IsEmpty())
+	require.True(t, source.ContentBounds[2].IsEmpty())
+	require.Len(t, source.Columns, 3)
+
+	_, err = newSource(Document{Reader: src}, business.ResourceInfo{}, 0, doc, opts, []int{3})
+	require.Error(t, err)
+	_, err = newSource(Document{Reader: src}, business.ResourceInfo{}, 0, doc, opts, []int{0, 1, 0})
+	require.Error(t, err)
+}
+
+func TestConvertConcurrently(t *testing.T) {
+	content := fixture(3)
+	type result struct {
+		kpf []byte
+		err error
+	}
+	convert := func() result {
+		out := bytes.Buffer{}
+		_, err := Convert(context.Background(), io.NewSectionReader(content, 0, content.Size()), Options{Output: &out})
+		return result{out.Bytes(), err}
+	}
+	expected := convert()
+	require.NoError(t, expected.err)
+
+	// each conversion numbers its own ids
+	results := make(chan result)
+	for i := 0; i < 4; i++ {
+		go func() { results <- convert() }()
+	}
+	for i := 0; i < 4; i++ {
+		r := <-results
+		require.NoError(t, r.err)
+		require.Equal(t, expected.kpf, r.kpf)
+	}
+}
+
+func TestMarkPages(t *testing.T) {
+	sources := func() []business.Source {
+		return []business.Source{
+			{NumberOfPages: 2, Landmarks: map[business.LandmarkType]int{business.LandmarkStart: 1}},
+			{NumberOfPages: 3, Landmarks: map[business.LandmarkType]int{}},
+		}
+	}
+
+	// pages are numbered across the merged pdfs
+	merged := sources()
+	require.NoError(t, markPages(merged, pageOptions{coverPage: 1, startPage: 4}))
+	require.Equal(t, map[business.LandmarkType]int{business.LandmarkCover: 0}, merged[0].Landmarks)
+	require.Equal(t, map[business.LandmarkType]int{business.LandmarkStart: 1}, merged[1].Landmarks)
+
+	// the start page found in the outline is kept when not set
+	merged = sources()
+	require.NoError(t, markPages(merged, pageOptions{coverPage: 5}))
+	require.Equal(t, map[business.LandmarkType]int{business.LandmarkStart: 1}, merged[0].Landmarks)
+	require.Equal(t, map[business.LandmarkType]int{business.LandmarkCover: 2}, merged[1].Landmarks)
+
+	require.Error(t, markPages(sources(), pageOptions{coverPage: 6}))
+	require.Error(t, markPages(sources(), pageOptions{startPage: -1}))
+}
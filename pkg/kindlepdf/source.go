@@ -0,0 +1,242 @@
+package kindlepdf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"pdf_raw_printing/internal/business"
+	"pdf_raw_printing/internal/libs/pdfdoc"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// pageOptions are how the pages are cropped and split into views, and the
+// 1 based pages marked as landmarks, 0 when not set
+type pageOptions struct {
+	crop      string
+	autoCrop  business.AutoCrop
+	split     business.Split
+	columns   bool
+	coverPage int
+	startPage int
+}
+
+func newPageOptions(opts Options) (pageOptions, error) {
+	if opts.Columns && opts.Views != "" {
+		return pageOptions{}, errors.New("columns can't be used with views")
+	}
+
+	autoCropMode, err := business.ParseAutoCropMode(opts.AutoCrop)
+	if err != nil {
+		return pageOptions{}, err
+	}
+
+	split, err := business.ParseSplit(opts.Views)
+	if err != nil {
+		return pageOptions{}, err
+	}
+	if opts.ViewsOverlap < 0 || opts.ViewsOverlap >= 100 {
+		return pageOptions{}, fmt.Errorf("invalid views overlap %v, expected a percent from 0 to less than 100", opts.ViewsOverlap)
+	}
+	split.Overlap = opts.ViewsOverlap
+	split.RTL = opts.ViewsRTL
+
+	return pageOptions{
+		crop:      opts.Crop,
+		autoCrop:  business.AutoCrop{Mode: autoCropMode, Padding: opts.CropPadding},
+		split:     split,
+		columns:   opts.Columns,
+		coverPage: opts.CoverPage,
+		startPage: opts.StartPage,
+	}, nil
+}
+
+// sizeOf returns the size of a reader that knows it, as bytes.Reader,
+// io.SectionReader or os.File
+func sizeOf(r io.ReaderAt) (int64, error) {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size(), nil
+	case interface{ Stat() (fs.FileInfo, error) }:
+		stat, err := r.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return stat.Size(), nil
+	}
+	return 0, errors.New("unknown size of the reader, wrap it in an io.SectionReader")
+}
+
+// modTimeOf returns the unix modification time of a file, 0 for other
+// readers
+func modTimeOf(r io.ReaderAt) int64 {
+	if f, ok := r.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		if stat, err := f.Stat(); err == nil {
+			return stat.ModTime().Unix()
+		}
+	}
+	return 0
+}
+
+// readInfo hashes an input, its date being the modification time of a file
+func readInfo(r io.ReaderAt) (business.ResourceInfo, error) {
+	size, err := sizeOf(r)
+	if err != nil {
+		return business.ResourceInfo{}, err
+	}
+	return business.ReadResourceInfoAt(r, size, modTimeOf(r))
+}
+
+// openDocument parses a pdf
+func openDocument(r io.ReaderAt) (*pdfdoc.Document, error) {
+	size, err := sizeOf(r)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := pdf.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return pdfdoc.New(reader), nil
+}
+
+// newSource describes the i-th pdf of a book, read from d, with the size,
+// the crop and the views of its pages. pages are the 0 based pages in the
+// book, every page when empty, the content of the others not being read.
+func newSource(d Document, info business.ResourceInfo, i int, doc *pdfdoc.Document, opts pageOptions, pages []int) (business.Source, error) {
+	crop, err := business.ParseCrop(opts.crop, doc.NumPage())
+	if err != nil {
+		return business.Source{}, err
+	}
+
+	seen := map[int]bool{}
+	for _, page := range pages {
+		if page < 0 || page >= doc.NumPage() {
+			return business.Source{}, fmt.Errorf("invalid page index %d, the pdf has %d pages", page, doc.NumPage())
+		}
+		if seen[page] {
+			return business.Source{}, fmt.Errorf("page index %d selected twice", page)
+		}
+		seen[page] = true
+	}
+	selected := pages
+	if len(selected) == 0 {
+		selected, _ = business.ParsePages("", doc.NumPage())
+	}
+
+	pageSizes := []business.PageSize{}
+	for page := 0; page < doc.NumPage(); page++ {
+		width, height, _ := doc.PageSize(page)
+		pageSizes = append(pageSizes, business.PageSize{Width: width, Height: height})
+	}
+
+	// the content streams are only interpreted for the selected pages
+	contentBounds := []business.Bounds{}
+	if opts.autoCrop.Mode != business.AutoCropNone {
+		contentBounds = make([]business.Bounds, doc.NumPage())
+		for _, page := range selected {
+			box, _ := doc.ContentBounds(page)
+			contentBounds[page] = business.Bounds(box)
+		}
+	}
+
+	columns := [][]business.Bounds{}
+	if opts.columns {
+		columns = make([][]business.Bounds, doc.NumPage())
+		for _, page := range selected {
+			boxes, _ := doc.Columns(page)
+			for _, box := range boxes {
+				columns[page] = append(columns[page], business.Bounds(box))
+			}
+		}
+	}
+
+	links := [][]business.Link{}
+	for page := 0; page < doc.NumPage(); page++ {
+		pageLinks := []business.Link{}
+		for _, link := range doc.Links(page) {
+			pageLinks = append(pageLinks, business.Link{
+				Bounds:    business.Bounds(link.Box),
+				PageIndex: link.PageIndex,
+				URI:       link.URI,
+			})
+		}
+		links = append(links, pageLinks)
+	}
+
+	landmarks := map[business.LandmarkType]int{}
+	if page, ok := doc.StartPage(); ok {
+		landmarks[business.LandmarkStart] = page
+	}
+
+	return business.Source{
+		Path:          d.Name,
+		Reader:        d.Reader,
+		Resource:      business.ResourceName(i),
+		Info:          info,
+		Title:         doc.Reader.Outline().Title,
+		NumberOfPages: doc.NumPage(),
+		Pages:         pages,
+		PageSizes:     pageSizes,
+		Crop:          crop,
+		ContentBounds: contentBounds,
+		AutoCrop:      opts.autoCrop,
+		Split:         opts.split,
+		Columns:       columns,
+		PageLabels:    doc.PageLabels(),
+		Links:         links,
+		DocumentId:    doc.ID(),
+		Landmarks:     landmarks,
+	}, nil
+}
+
+// markPages marks the cover page and the start page of a book, numbered
+// from 1 across its pdfs in order. An explicit start page replaces the ones
+// found in the outlines.
+func markPages(sources []business.Source, opts pageOptions) error {
+	total := 0
+	for _, source := range sources {
+		total += source.NumberOfPages
+	}
+
+	for _, l := range []struct {
+		name     string
+		landmark business.LandmarkType
+		page     int
+	}{
+		{"cover page", business.LandmarkCover, opts.coverPage},
+		{"start page", business.LandmarkStart, opts.startPage},
+	} {
+		if l.page < 0 || l.page > total {
+			return fmt.Errorf("invalid %s %d, the book has %d pages", l.name, l.page, total)
+		}
+		if l.page == 0 {
+			continue
+		}
+
+		index := l.page - 1
+		for i := range sources {
+			delete(sources[i].Landmarks, l.landmark)
+		}
+		for i := range sources {
+			if index < sources[i].NumberOfPages {
+				sources[i].Landmarks[l.landmark] = index
+				break
+			}
+			index -= sources[i].NumberOfPages
+		}
+	}
+	return nil
+}
+
+// trimExt removes the .pdf extension of a file name
+func trimExt(name string) string {
+	name = path.Base(name)
+	if strings.HasSuffix(strings.ToLower(name), ".pdf") {
+		return name[:len(name)-len(".pdf")]
+	}
+	return name
+}
@@ -0,0 +1,90 @@
+package kindlepdf
+
+import (
+	"fmt"
+	"io"
+	"pdf_raw_printing/internal/business"
+)
+
+// VolumeOptions are how a pdf is split into books
+type VolumeOptions struct {
+	// Pages selects the pages, such as 1-20,35,40-, every page when empty
+	Pages string
+	// Every splits the selected pages into volumes of Every pages
+	Every int
+	// ByOutline splits the selected pages into one volume per top level
+	// outline entry
+	ByOutline bool
+	// Name is the file name of the pdf, titling the volumes when its outline
+	// has no title
+	Name string
+}
+
+// Volume is a book made of some pages of a pdf, converted with Options.Title
+// and Options.Pages set to Title and Pages
+type Volume struct {
+	Title string
+	// Pages are 0 based
+	Pages []int
+}
+
+// Volumes splits the pages of a pdf into volumes
+func Volumes(src io.ReaderAt, opts VolumeOptions) ([]Volume, error) {
+	doc, err := openDocument(src)
+	if err != nil {
+		return nil, err
+	}
+	title := doc.Reader.Outline().Title
+	if title == "" && opts.Name != "" {
+		title = trimExt(opts.Name)
+	}
+
+	pages, err := business.ParsePages(opts.Pages, doc.NumPage())
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ByOutline {
+		starts := []int{}
+		titles := map[int]string{}
+		for _, entry := range doc.Outline() {
+			if entry.PageIndex >= 0 {
+				starts = append(starts, entry.PageIndex)
+				titles[entry.PageIndex] = entry.Title
+			}
+		}
+
+		volumes := []Volume{}
+		for _, v := range business.SplitAt(pages, starts) {
+			volumeTitle := title
+			for _, page := range v {
+				if t, exists := titles[page]; exists {
+					volumeTitle = t
+					break
+				}
+			}
+			volumes = append(volumes, Volume{Title: volumeTitle, Pages: v})
+		}
+		return volumes, nil
+	}
+
+	splits := business.SplitEvery(pages, opts.Every)
+	volumes := []Volume{}
+	for i, v := range splits {
+		volumeTitle := title
+		if len(splits) > 1 {
+			volumeTitle = volumeName(title, i)
+		}
+		volumes = append(volumes, Volume{Title: volumeTitle, Pages: v})
+	}
+	return volumes, nil
+}
+
+// volumeName titles the i-th volume of a book, Volume n when the book has no
+// title
+func volumeName(title string, i int) string {
+	if title == "" {
+		return fmt.Sprintf("Volume %d", i+1)
+	}
+	return fmt.Sprintf("%s %d", title, i+1)
+}